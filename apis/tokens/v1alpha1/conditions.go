@@ -0,0 +1,73 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+)
+
+// TypeTokenValid resources report whether Argo CD accepts the stored token.
+const TypeTokenValid xpv1.ConditionType = "TokenValid"
+
+// Reasons a token is or is not valid.
+const (
+	ReasonTokenAccepted xpv1.ConditionReason = "TokenAccepted"
+	ReasonTokenRejected xpv1.ConditionReason = "TokenRejected"
+)
+
+// TokenAccepted returns a condition that indicates Argo CD accepts the
+// stored token.
+func TokenAccepted() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeTokenValid,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonTokenAccepted,
+	}
+}
+
+// TokenRejected returns a condition that indicates Argo CD rejects the
+// stored token.
+func TokenRejected(msg string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeTokenValid,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonTokenRejected,
+		Message:            msg,
+	}
+}
+
+// TypeClusterReachable resources report whether the cluster the token secret
+// is written to can be reached.
+const TypeClusterReachable xpv1.ConditionType = "ClusterReachable"
+
+// Reasons a cluster is or is not reachable.
+const (
+	ReasonClusterReachable   xpv1.ConditionReason = "ClusterReachable"
+	ReasonClusterUnreachable xpv1.ConditionReason = "ClusterUnreachable"
+)
+
+// ClusterReachable returns a condition that indicates the cluster the token
+// secret is written to can be reached.
+func ClusterReachable() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeClusterReachable,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonClusterReachable,
+	}
+}
+
+// ClusterUnreachable returns a condition that indicates the cluster the token
+// secret is written to cannot be reached.
+func ClusterUnreachable(msg string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               TypeClusterReachable,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonClusterUnreachable,
+		Message:            msg,
+	}
+}
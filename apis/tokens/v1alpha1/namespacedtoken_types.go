@@ -0,0 +1,100 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+)
+
+// LocalTokenSecretReference is the reference to the secret, in the namespace
+// of the NamespacedToken, the token is written to.
+type LocalTokenSecretReference struct {
+	// Name of the secret.
+	Name string `json:"name"`
+
+	// Key of the secret the token is written to.
+	Key string `json:"key"`
+
+	// Metadata labels, annotations and type of the secret.
+	// +optional
+	Metadata *xpv1.ConnectionSecretMetadata `json:"metadata,omitempty"`
+
+	// Immutable marks the secret as immutable: it is then replaced, instead of
+	// updated, whenever the token changes.
+	// +optional
+	Immutable bool `json:"immutable,omitempty"`
+}
+
+// NamespacedTokenParameters are the configurable fields of a NamespacedToken.
+type NamespacedTokenParameters struct {
+	CommonTokenParameters `json:",inline"`
+
+	WriteTokenSecretToRef LocalTokenSecretReference `json:"writeTokenSecretToRef"`
+}
+
+// A NamespacedTokenSpec defines the desired state of a NamespacedToken.
+type NamespacedTokenSpec struct {
+	xpv1.ResourceSpec `json:",inline"`
+	ForProvider       NamespacedTokenParameters `json:"forProvider"`
+}
+
+// A NamespacedTokenStatus represents the observed state of a NamespacedToken.
+type NamespacedTokenStatus struct {
+	xpv1.ResourceStatus `json:",inline"`
+	AtProvider          TokenObservation `json:"atProvider,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// A NamespacedToken is a Token whose secret is always written to its own
+// namespace, so that it can be granted to tenants with namespace RBAC.
+// +kubebuilder:printcolumn:name="READY",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+// +kubebuilder:printcolumn:name="SYNCED",type="string",JSONPath=".status.conditions[?(@.type=='Synced')].status"
+// +kubebuilder:printcolumn:name="EXPIRES",type="string",JSONPath=".status.atProvider.expiresAt"
+// +kubebuilder:printcolumn:name="TOKEN-ID",type="string",JSONPath=".status.atProvider.id"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:resource:scope=Namespaced,categories={crossplane,managed,argocd}
+// +kubebuilder:subresource:status
+type NamespacedToken struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NamespacedTokenSpec   `json:"spec"`
+	Status NamespacedTokenStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NamespacedTokenList contains a list of NamespacedToken
+type NamespacedTokenList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NamespacedToken `json:"items"`
+}
+
+// GetTokenParameters returns the configurable fields of the NamespacedToken,
+// targeting a secret in its own namespace.
+func (mg *NamespacedToken) GetTokenParameters() TokenParameters {
+	params := mg.Spec.ForProvider.DeepCopy()
+	ref := params.WriteTokenSecretToRef
+
+	return TokenParameters{
+		CommonTokenParameters: params.CommonTokenParameters,
+		WriteTokenSecretToRef: TokenSecretReference{
+			SecretKeySelector: xpv1.SecretKeySelector{
+				SecretReference: xpv1.SecretReference{
+					Name:      ref.Name,
+					Namespace: mg.GetNamespace(),
+				},
+				Key: ref.Key,
+			},
+			Metadata:  ref.Metadata,
+			Immutable: ref.Immutable,
+		},
+	}
+}
+
+// GetTokenObservation returns the observable fields of the NamespacedToken.
+func (mg *NamespacedToken) GetTokenObservation() *TokenObservation {
+	return &mg.Status.AtProvider
+}
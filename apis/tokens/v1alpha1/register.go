@@ -28,6 +28,15 @@ var (
 	TokenGroupVersionKind = SchemeGroupVersion.WithKind(TokenKind)
 )
 
+// NamespacedToken type metadata
+var (
+	NamespacedTokenKind             = reflect.TypeOf(NamespacedToken{}).Name()
+	NamespacedTokenGroupKind        = schema.GroupKind{Group: Group, Kind: NamespacedTokenKind}.String()
+	NamespacedTokenKindAPIVersion   = NamespacedTokenKind + "." + SchemeGroupVersion.String()
+	NamespacedTokenGroupVersionKind = SchemeGroupVersion.WithKind(NamespacedTokenKind)
+)
+
 func init() {
 	SchemeBuilder.Register(&Token{}, &TokenList{})
+	SchemeBuilder.Register(&NamespacedToken{}, &NamespacedTokenList{})
 }
@@ -6,14 +6,122 @@ import (
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 )
 
+const (
+	// AnnotationKeyRotateRequestedAt requests an on-demand rotation of a Token.
+	// Every new value (i.e. a timestamp) triggers a single rotation.
+	AnnotationKeyRotateRequestedAt = Group + "/rotate-requested-at"
+
+	// LabelKeyManagedBy marks the secrets written by this provider.
+	LabelKeyManagedBy = "app.kubernetes.io/managed-by"
+
+	// LabelKeyToken links a secret to the Token that owns it.
+	LabelKeyToken = Group + "/token"
+
+	// LabelKeyNamespacedToken links a secret to the NamespacedToken that owns it.
+	LabelKeyNamespacedToken = Group + "/namespaced-token"
+
+	// LabelKeyNamespacedTokenNamespace holds the namespace of the
+	// NamespacedToken that owns a secret, since NamespacedTokens with the same
+	// name may live in different namespaces.
+	LabelKeyNamespacedTokenNamespace = Group + "/namespaced-token-namespace"
+)
+
+// SecretPolicy defines how to handle a token secret that already exists
+// and is not owned by the Token.
+// +kubebuilder:validation:Enum=FailIfExists;Adopt;Overwrite
+type SecretPolicy string
+
+const (
+	// SecretPolicyFailIfExists refuses to write into the existing secret.
+	SecretPolicyFailIfExists SecretPolicy = "FailIfExists"
+
+	// SecretPolicyAdopt takes ownership of the existing secret, keeping its other values.
+	SecretPolicyAdopt SecretPolicy = "Adopt"
+
+	// SecretPolicyOverwrite takes ownership of the existing secret, dropping its other values.
+	SecretPolicyOverwrite SecretPolicy = "Overwrite"
+)
+
+// TokenRevocation is a replaced token waiting to be revoked.
+type TokenRevocation struct {
+	// ID of the replaced token.
+	ID string `json:"id"`
+
+	// Account the replaced token has been issued for.
+	// +optional
+	Account string `json:"account,omitempty"`
+
+	// RevokeAt time the replaced token will be revoked at.
+	RevokeAt metav1.Time `json:"revokeAt"`
+}
+
 // TokenObservation are the observable fields of a Token.
 type TokenObservation struct {
-	ID        string `json:"id,omitempty"`
+	// ID of the token.
+	ID string `json:"id,omitempty"`
+
+	// Account the token has been issued for.
+	Account string `json:"account,omitempty"`
+
+	// Fingerprint SHA-256 of the token written into the secret.
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// Subject the token has been issued for.
+	Subject string `json:"subject,omitempty"`
+
+	// ExpiresIn duration before the token will expire.
 	ExpiresIn string `json:"expiresIn,omitempty"`
+
+	// IssuedAt time the token has been issued at.
+	IssuedAt *metav1.Time `json:"issuedAt,omitempty"`
+
+	// ExpiresAt time the token will expire at.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// LastRotationTime time the token has been last rotated at.
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+
+	// NextRotationTime time the token will be rotated at.
+	NextRotationTime *metav1.Time `json:"nextRotationTime,omitempty"`
+
+	// LastRotationRequest last value of the rotate-requested-at annotation
+	// that has been handled.
+	LastRotationRequest string `json:"lastRotationRequest,omitempty"`
+
+	// PendingRevocations replaced tokens still valid during the rotation grace period.
+	PendingRevocations []TokenRevocation `json:"pendingRevocations,omitempty"`
+
+	// SecretTemplateKeys keys of the token secret rendered from the secret
+	// template, removed once no longer templated.
+	SecretTemplateKeys []string `json:"secretTemplateKeys,omitempty"`
 }
 
-// TokenParameters are the configurable fields of of a Token.
-type TokenParameters struct {
+// TokenSecretReference is the reference to the secret the token is written to.
+type TokenSecretReference struct {
+	xpv1.SecretKeySelector `json:",inline"`
+
+	// NamespaceSelector selects the namespaces a copy of the secret is kept in,
+	// besides its own namespace.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// KubeconfigSecretRef references the kubeconfig of the cluster the secret
+	// is written to. (Default: the cluster the provider runs in)
+	// +optional
+	KubeconfigSecretRef *xpv1.SecretKeySelector `json:"kubeconfigSecretRef,omitempty"`
+
+	// Metadata labels, annotations and type of the secret.
+	// +optional
+	Metadata *xpv1.ConnectionSecretMetadata `json:"metadata,omitempty"`
+
+	// Immutable marks the secret as immutable: it is then replaced, instead of
+	// updated, whenever the token changes.
+	// +optional
+	Immutable bool `json:"immutable,omitempty"`
+}
+
+// CommonTokenParameters are the configurable fields shared by all kinds of tokens.
+type CommonTokenParameters struct {
 	// ID optional token id. Fall back to uuid if not value specified
 	// +optional
 	ID string `json:"id,omitempty"`
@@ -23,9 +131,42 @@ type TokenParameters struct {
 
 	// ExpiresIn duration before the token will expire. (Default: No expiration)
 	// +optional
-	// ExpiresIn string `json:"expiresIn,omitempty"`
+	ExpiresIn *metav1.Duration `json:"expiresIn,omitempty"`
+
+	// RenewBefore duration before the expiration at which the token will be renewed.
+	// Expired tokens are always renewed. (Default: renew on expiration)
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+
+	// RotationSchedule cron expression of the token rotations (i.e. '0 0 1 * *').
+	// Tokens are rotated on schedule even if they never expire.
+	// +optional
+	RotationSchedule string `json:"rotationSchedule,omitempty"`
 
-	WriteTokenSecretToRef xpv1.SecretKeySelector `json:"writeTokenSecretToRef"`
+	// RotationGracePeriod duration the replaced token stays valid after a rotation.
+	// Meanwhile it is kept in the secret under the 'previousToken' key.
+	// (Default: revoke immediately)
+	// +optional
+	RotationGracePeriod *metav1.Duration `json:"rotationGracePeriod,omitempty"`
+
+	// SecretTemplate renders additional keys into the token secret. Each value
+	// is a Go template executed with .Token, .ID, .Account, .ServerURL,
+	// .ServerAddr and .ExpiresAt (i.e. 'Bearer {{ .Token }}').
+	// +optional
+	SecretTemplate map[string]string `json:"secretTemplate,omitempty"`
+
+	// SecretPolicy defines what to do when the token secret already exists
+	// and is not owned by the token. (Default: FailIfExists)
+	// +optional
+	// +kubebuilder:default=FailIfExists
+	SecretPolicy SecretPolicy `json:"secretPolicy,omitempty"`
+}
+
+// TokenParameters are the configurable fields of of a Token.
+type TokenParameters struct {
+	CommonTokenParameters `json:",inline"`
+
+	WriteTokenSecretToRef TokenSecretReference `json:"writeTokenSecretToRef"`
 }
 
 // A TokenSpec defines the desired state of a Token.
@@ -44,6 +185,8 @@ type TokenStatus struct {
 
 // +kubebuilder:printcolumn:name="READY",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
 // +kubebuilder:printcolumn:name="SYNCED",type="string",JSONPath=".status.conditions[?(@.type=='Synced')].status"
+// +kubebuilder:printcolumn:name="EXPIRES",type="string",JSONPath=".status.atProvider.expiresAt"
+// +kubebuilder:printcolumn:name="TOKEN-ID",type="string",JSONPath=".status.atProvider.id"
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:resource:scope=Cluster,categories={crossplane,managed,argocd}
 // +kubebuilder:subresource:status
@@ -63,3 +206,13 @@ type TokenList struct {
 	metav1.ListMeta `json:"metadata,omitempty"`
 	Items           []Token `json:"items"`
 }
+
+// GetTokenParameters returns the configurable fields of the Token.
+func (mg *Token) GetTokenParameters() TokenParameters {
+	return *mg.Spec.ForProvider.DeepCopy()
+}
+
+// GetTokenObservation returns the observable fields of the Token.
+func (mg *Token) GetTokenObservation() *TokenObservation {
+	return &mg.Status.AtProvider
+}
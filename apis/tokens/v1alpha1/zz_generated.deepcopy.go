@@ -22,9 +22,178 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"github.com/crossplane/crossplane-runtime/apis/common/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CommonTokenParameters) DeepCopyInto(out *CommonTokenParameters) {
+	*out = *in
+	if in.ExpiresIn != nil {
+		in, out := &in.ExpiresIn, &out.ExpiresIn
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RotationGracePeriod != nil {
+		in, out := &in.RotationGracePeriod, &out.RotationGracePeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.SecretTemplate != nil {
+		in, out := &in.SecretTemplate, &out.SecretTemplate
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CommonTokenParameters.
+func (in *CommonTokenParameters) DeepCopy() *CommonTokenParameters {
+	if in == nil {
+		return nil
+	}
+	out := new(CommonTokenParameters)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalTokenSecretReference) DeepCopyInto(out *LocalTokenSecretReference) {
+	*out = *in
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = new(v1.ConnectionSecretMetadata)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalTokenSecretReference.
+func (in *LocalTokenSecretReference) DeepCopy() *LocalTokenSecretReference {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalTokenSecretReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedToken) DeepCopyInto(out *NamespacedToken) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedToken.
+func (in *NamespacedToken) DeepCopy() *NamespacedToken {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedToken)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespacedToken) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedTokenList) DeepCopyInto(out *NamespacedTokenList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NamespacedToken, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedTokenList.
+func (in *NamespacedTokenList) DeepCopy() *NamespacedTokenList {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedTokenList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespacedTokenList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedTokenParameters) DeepCopyInto(out *NamespacedTokenParameters) {
+	*out = *in
+	in.CommonTokenParameters.DeepCopyInto(&out.CommonTokenParameters)
+	in.WriteTokenSecretToRef.DeepCopyInto(&out.WriteTokenSecretToRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedTokenParameters.
+func (in *NamespacedTokenParameters) DeepCopy() *NamespacedTokenParameters {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedTokenParameters)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedTokenSpec) DeepCopyInto(out *NamespacedTokenSpec) {
+	*out = *in
+	in.ResourceSpec.DeepCopyInto(&out.ResourceSpec)
+	in.ForProvider.DeepCopyInto(&out.ForProvider)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedTokenSpec.
+func (in *NamespacedTokenSpec) DeepCopy() *NamespacedTokenSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedTokenSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedTokenStatus) DeepCopyInto(out *NamespacedTokenStatus) {
+	*out = *in
+	in.ResourceStatus.DeepCopyInto(&out.ResourceStatus)
+	in.AtProvider.DeepCopyInto(&out.AtProvider)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedTokenStatus.
+func (in *NamespacedTokenStatus) DeepCopy() *NamespacedTokenStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedTokenStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Token) DeepCopyInto(out *Token) {
 	*out = *in
@@ -87,6 +256,34 @@ func (in *TokenList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TokenObservation) DeepCopyInto(out *TokenObservation) {
 	*out = *in
+	if in.IssuedAt != nil {
+		in, out := &in.IssuedAt, &out.IssuedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRotationTime != nil {
+		in, out := &in.LastRotationTime, &out.LastRotationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextRotationTime != nil {
+		in, out := &in.NextRotationTime, &out.NextRotationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.PendingRevocations != nil {
+		in, out := &in.PendingRevocations, &out.PendingRevocations
+		*out = make([]TokenRevocation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SecretTemplateKeys != nil {
+		in, out := &in.SecretTemplateKeys, &out.SecretTemplateKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenObservation.
@@ -102,7 +299,8 @@ func (in *TokenObservation) DeepCopy() *TokenObservation {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TokenParameters) DeepCopyInto(out *TokenParameters) {
 	*out = *in
-	out.WriteTokenSecretToRef = in.WriteTokenSecretToRef
+	in.CommonTokenParameters.DeepCopyInto(&out.CommonTokenParameters)
+	in.WriteTokenSecretToRef.DeepCopyInto(&out.WriteTokenSecretToRef)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenParameters.
@@ -115,11 +313,58 @@ func (in *TokenParameters) DeepCopy() *TokenParameters {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenRevocation) DeepCopyInto(out *TokenRevocation) {
+	*out = *in
+	in.RevokeAt.DeepCopyInto(&out.RevokeAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenRevocation.
+func (in *TokenRevocation) DeepCopy() *TokenRevocation {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenRevocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenSecretReference) DeepCopyInto(out *TokenSecretReference) {
+	*out = *in
+	out.SecretKeySelector = in.SecretKeySelector
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KubeconfigSecretRef != nil {
+		in, out := &in.KubeconfigSecretRef, &out.KubeconfigSecretRef
+		*out = new(v1.SecretKeySelector)
+		**out = **in
+	}
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = new(v1.ConnectionSecretMetadata)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenSecretReference.
+func (in *TokenSecretReference) DeepCopy() *TokenSecretReference {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenSecretReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TokenSpec) DeepCopyInto(out *TokenSpec) {
 	*out = *in
 	in.ResourceSpec.DeepCopyInto(&out.ResourceSpec)
-	out.ForProvider = in.ForProvider
+	in.ForProvider.DeepCopyInto(&out.ForProvider)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenSpec.
@@ -136,7 +381,7 @@ func (in *TokenSpec) DeepCopy() *TokenSpec {
 func (in *TokenStatus) DeepCopyInto(out *TokenStatus) {
 	*out = *in
 	in.ResourceStatus.DeepCopyInto(&out.ResourceStatus)
-	out.AtProvider = in.AtProvider
+	in.AtProvider.DeepCopyInto(&out.AtProvider)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenStatus.
@@ -19,6 +19,15 @@ package v1alpha1
 
 import resource "github.com/crossplane/crossplane-runtime/pkg/resource"
 
+// GetItems of this NamespacedTokenList.
+func (l *NamespacedTokenList) GetItems() []resource.Managed {
+	items := make([]resource.Managed, len(l.Items))
+	for i := range l.Items {
+		items[i] = &l.Items[i]
+	}
+	return items
+}
+
 // GetItems of this TokenList.
 func (l *TokenList) GetItems() []resource.Managed {
 	items := make([]resource.Managed, len(l.Items))
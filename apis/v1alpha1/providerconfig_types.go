@@ -6,13 +6,44 @@ import (
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 )
 
+// CredentialsType is the kind of credentials read from the source.
+// +kubebuilder:validation:Enum=Password;Token
+type CredentialsType string
+
+const (
+	// CredentialsTypePassword credentials are the password of the account
+	// the provider logs in with.
+	CredentialsTypePassword CredentialsType = "Password"
+
+	// CredentialsTypeToken credentials are a pre-issued API token the
+	// provider authenticates with, without logging in.
+	CredentialsTypeToken CredentialsType = "Token"
+)
+
 // ProviderCredentials required to authenticate.
 type ProviderCredentials struct {
 	// Source of the provider credentials.
-	// +kubebuilder:validation:Enum=None;Secret;Environment
+	// +kubebuilder:validation:Enum=None;Secret;Environment;Filesystem
 	Source xpv1.CredentialsSource `json:"source"`
 
+	// Type of the provider credentials: either the Password of the account to
+	// log in with, or a pre-issued API Token (i.e. when local logins are
+	// disabled). (Default: Password)
+	// +optional
+	// +kubebuilder:default=Password
+	Type CredentialsType `json:"type,omitempty"`
+
 	xpv1.CommonCredentialSelectors `json:",inline"`
+
+	// Username of the account to log in with, with Password credentials.
+	// (Default: admin)
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// UsernameSecretRef references the secret key holding the username of the
+	// account to log in with. It takes precedence over Username.
+	// +optional
+	UsernameSecretRef *xpv1.SecretKeySelector `json:"usernameSecretRef,omitempty"`
 }
 
 // A ProviderConfigSpec defines the desired state of a ProviderConfig.
@@ -30,6 +61,84 @@ type ProviderConfigSpec struct {
 
 	// Credentials required to authenticate to this provider.
 	Credentials *ProviderCredentials `json:"credentials,omitempty"`
+
+	// TLS configures the connections to the argocd instance.
+	// +optional
+	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// AllowedSecretNamespaces restricts the namespaces the tokens minted with
+	// this provider config may be written to. (Default: any namespace)
+	// +optional
+	AllowedSecretNamespaces *AllowedNamespaces `json:"allowedSecretNamespaces,omitempty"`
+
+	// NamespacedTokenAccounts lists the accounts NamespacedTokens may mint
+	// tokens for with this provider config. NamespacedTokens of any other
+	// account are refused. (Default: none)
+	// +optional
+	NamespacedTokenAccounts []string `json:"namespacedTokenAccounts,omitempty"`
+}
+
+// TLSVersion is a TLS protocol version.
+// +kubebuilder:validation:Enum="1.0";"1.1";"1.2";"1.3"
+type TLSVersion string
+
+// TLSConfig configures how the argocd server certificate is verified and
+// which client certificate is presented to it.
+type TLSConfig struct {
+	// CABundleSecretRef references the secret key holding the PEM encoded
+	// CA certificates the argocd server certificate is verified with.
+	// (Default: the system CA certificates)
+	// +optional
+	CABundleSecretRef *xpv1.SecretKeySelector `json:"caBundleSecretRef,omitempty"`
+
+	// CABundleConfigMapRef references the config map key holding the PEM
+	// encoded CA certificates the argocd server certificate is verified with.
+	// (Default: the system CA certificates)
+	// +optional
+	CABundleConfigMapRef *ConfigMapKeySelector `json:"caBundleConfigMapRef,omitempty"`
+
+	// ClientCertSecretRef references a kubernetes.io/tls secret holding the
+	// client certificate (tls.crt) and key (tls.key) presented for mutual TLS.
+	// +optional
+	ClientCertSecretRef *xpv1.SecretReference `json:"clientCertSecretRef,omitempty"`
+
+	// ServerName the argocd server certificate is verified against.
+	// (Default: the serverUrl host)
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+
+	// MinVersion is the minimum TLS version accepted. (Default: 1.2)
+	// +optional
+	MinVersion TLSVersion `json:"minVersion,omitempty"`
+
+	// InsecureSkipVerify disables the verification of the argocd server
+	// certificate. Only meant for test setups.
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// ConfigMapKeySelector references a key of a config map.
+type ConfigMapKeySelector struct {
+	// Name of the config map.
+	Name string `json:"name"`
+
+	// Namespace of the config map.
+	Namespace string `json:"namespace"`
+
+	// Key whose value will be used.
+	Key string `json:"key"`
+}
+
+// AllowedNamespaces selects namespaces by name and/or labels: a namespace is
+// allowed if either listed or selected.
+type AllowedNamespaces struct {
+	// Names of the allowed namespaces.
+	// +optional
+	Names []string `json:"names,omitempty"`
+
+	// Selector of the allowed namespaces.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
 }
 
 // A ProviderConfigStatus reflects the observed state of a ProviderConfig.
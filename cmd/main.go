@@ -1,20 +1,30 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 
 	"github.com/crossplane/crossplane-runtime/pkg/controller"
 	"gopkg.in/alecthomas/kingpin.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	"github.com/crossplane/crossplane-runtime/pkg/feature"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/crossplane-runtime/pkg/ratelimiter"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
 
 	"github.com/krateoplatformops/provider-argocd-token/apis"
+	argocdv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/v1alpha1"
 	argocdtoken "github.com/krateoplatformops/provider-argocd-token/pkg/controller"
+	"github.com/krateoplatformops/provider-argocd-token/pkg/features"
+	"github.com/krateoplatformops/provider-argocd-token/pkg/webhook"
 )
 
 func main() {
@@ -25,6 +35,15 @@ func main() {
 		pollInterval     = app.Flag("poll", "How often individual resources will be checked for drift from the desired state").Default("5m").Duration()
 		maxReconcileRate = app.Flag("max-reconcile-rate", "The global maximum rate per second at which resources may checked for drift from the desired state.").Default("2").Int()
 		leaderElection   = app.Flag("leader-election", "Use leader election for the controller manager.").Short('l').Default("false").OverrideDefaultFromEnvar("LEADER_ELECTION").Bool()
+		namespace        = app.Flag("namespace", "Namespace the provider runs in, used as default scope in the default secret store config and for the webhook service.").Default("crossplane-system").Envar("POD_NAMESPACE").String()
+
+		enableExternalSecretStores = app.Flag("enable-external-secret-stores", "Enable support for External Secret Stores.").Default("false").Envar("ENABLE_EXTERNAL_SECRET_STORES").Bool()
+
+		enableWebhooks     = app.Flag("enable-webhooks", "Enable the admission webhooks of Tokens and ProviderConfigs.").Default("false").Envar("ENABLE_WEBHOOKS").Bool()
+		webhookPort        = app.Flag("webhook-port", "Port the webhook server listens on.").Default("9443").Envar("WEBHOOK_PORT").Int()
+		webhookCertDir     = app.Flag("webhook-cert-dir", "Directory the self-signed webhook serving certificates are written to.").Default("/tmp/k8s-webhook-server/serving-certs").Envar("WEBHOOK_CERT_DIR").String()
+		webhookServiceName = app.Flag("webhook-service-name", "Name of the service exposing the webhook server in the provider namespace.").Default("provider-argocd-token-webhook").Envar("WEBHOOK_SERVICE_NAME").String()
+		webhookSecretName  = app.Flag("webhook-secret-name", "Name of the secret sharing the webhook serving certificates among replicas in the provider namespace.").Default("provider-argocd-token-webhook-tls").Envar("WEBHOOK_SECRET_NAME").String()
 	)
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 
@@ -47,6 +66,8 @@ func main() {
 		LeaderElectionID:   "crossplane-leader-election-provider-argocd-token",
 		SyncPeriod:         syncPeriod,
 		MetricsBindAddress: ":9090",
+		Port:               *webhookPort,
+		CertDir:            *webhookCertDir,
 	})
 	kingpin.FatalIfError(err, "Cannot create controller manager")
 
@@ -60,6 +81,47 @@ func main() {
 		Features:                &feature.Flags{},
 	}
 
+	if *enableExternalSecretStores {
+		o.Features.Enable(features.EnableAlphaExternalSecretStores)
+		log.Info("Alpha feature enabled", "flag", features.EnableAlphaExternalSecretStores)
+
+		// Ensure the default store config exists.
+		kingpin.FatalIfError(resource.Ignore(apierrors.IsAlreadyExists, mgr.GetClient().Create(context.Background(), &argocdv1alpha1.StoreConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "default",
+			},
+			Spec: argocdv1alpha1.StoreConfigSpec{
+				SecretStoreConfig: xpv1.SecretStoreConfig{
+					DefaultScope: *namespace,
+				},
+			},
+		})), "Cannot create default store config")
+	}
+
 	kingpin.FatalIfError(argocdtoken.Setup(mgr, o), "Cannot setup ArgoCD Token controller")
+
+	// The manager client cannot read before the manager starts.
+	kube, err := client.New(cfg, client.Options{Scheme: mgr.GetScheme()})
+	kingpin.FatalIfError(err, "Cannot create API server client")
+
+	if *enableWebhooks {
+		svc := webhook.Service{
+			Name:      *webhookServiceName,
+			Namespace: *namespace,
+			Port:      int32(*webhookPort),
+		}
+
+		secret := types.NamespacedName{Namespace: *namespace, Name: *webhookSecretName}
+		caBundle, err := webhook.EnsureCertificates(context.Background(), kube, secret, *webhookCertDir, svc.DNSNames())
+		kingpin.FatalIfError(err, "Cannot get webhook certificates")
+
+		kingpin.FatalIfError(webhook.Configure(context.Background(), kube, svc, caBundle), "Cannot configure webhooks")
+		kingpin.FatalIfError(webhook.Setup(mgr), "Cannot setup webhooks")
+		log.Info("Webhooks enabled", "service", svc.Name, "namespace", svc.Namespace, "port", svc.Port)
+	} else {
+		// Configurations left from a previous run would fail every admission.
+		kingpin.FatalIfError(webhook.Unconfigure(context.Background(), kube), "Cannot remove webhook configurations")
+	}
+
 	kingpin.FatalIfError(mgr.Start(ctrl.SetupSignalHandler()), "Cannot start controller manager")
 }
@@ -0,0 +1,38 @@
+package accounts
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Claims holds the claims of an Argo CD token.
+type Claims struct {
+	ID        string `json:"jti,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// ParseClaims decodes the claims of the specified JWT token.
+// The token signature is not verified.
+func ParseClaims(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed jwt token")
+	}
+
+	bin, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Claims{}
+	if err := json.Unmarshal(bin, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
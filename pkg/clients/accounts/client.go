@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"net/http/httputil"
+	"strings"
 )
 
 const (
@@ -27,15 +28,102 @@ func Login(opts *TokenProviderOptions, user, pass string) (string, error) {
 }
 
 // GenerateToken generate a token for the account with the specified name.
-// expiresIn specify the duration before the token will expire; by default: no expiration.
-func GenerateToken(opts *TokenProviderOptions, name string, expiresIn int64) (string, error) {
+// id is the token identifier; if empty Argo CD will fall back to an uuid.
+// expiresIn specify the duration in seconds before the token will expire; by default: no expiration.
+func GenerateToken(opts *TokenProviderOptions, name, id string, expiresIn int64) (string, error) {
 	cli, err := NewTokenProvider(opts)
 	if err != nil {
 		return "", err
 	}
 	cli.SetAuthToken(opts.AuthToken)
 
-	return cli.CreateTokenForAccount(name)
+	return cli.CreateTokenForAccount(name, id, expiresIn)
+}
+
+// DeleteToken revokes the token with the specified id for the account with the specified name.
+func DeleteToken(opts *TokenProviderOptions, name, id string) error {
+	cli, err := NewTokenProvider(opts)
+	if err != nil {
+		return err
+	}
+	cli.SetAuthToken(opts.AuthToken)
+
+	return cli.DeleteTokenForAccount(name, id)
+}
+
+// GetAccount returns the details of the account with the specified name.
+func GetAccount(opts *TokenProviderOptions, name string) (*Account, error) {
+	cli, err := NewTokenProvider(opts)
+	if err != nil {
+		return nil, err
+	}
+	cli.SetAuthToken(opts.AuthToken)
+
+	return cli.GetAccount(name)
+}
+
+// Account holds the details of an Argo CD account.
+type Account struct {
+	Name         string   `json:"name"`
+	Enabled      bool     `json:"enabled"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	Tokens       []Token  `json:"tokens,omitempty"`
+}
+
+// FindToken returns the account token with the specified id, nil if not found.
+func (a *Account) FindToken(id string) *Token {
+	for i := range a.Tokens {
+		if a.Tokens[i].ID == id {
+			return &a.Tokens[i]
+		}
+	}
+	return nil
+}
+
+// Token holds the details of an Argo CD account token.
+type Token struct {
+	ID        string `json:"id"`
+	IssuedAt  int64  `json:"issuedAt,string,omitempty"`
+	ExpiresAt int64  `json:"expiresAt,string,omitempty"`
+}
+
+// GetUserInfo returns the details of the user authenticated by the specified token.
+func GetUserInfo(opts *TokenProviderOptions, token string) (*UserInfo, error) {
+	// The token is not a session: when rejected there is nothing to renew.
+	o := *opts
+	o.Relogin = nil
+
+	cli, err := NewTokenProvider(&o)
+	if err != nil {
+		return nil, err
+	}
+	cli.SetAuthToken(token)
+
+	return cli.GetUserInfo()
+}
+
+// UserInfo holds the details of the user of an Argo CD session.
+type UserInfo struct {
+	LoggedIn bool     `json:"loggedIn"`
+	Username string   `json:"username,omitempty"`
+	Issuer   string   `json:"iss,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// ErrUnauthenticated is returned when Argo CD rejects the auth token.
+var ErrUnauthenticated = errors.New("argocd rejected the auth token")
+
+// IsUnauthenticated returns true if the error is due to Argo CD rejecting the auth token.
+func IsUnauthenticated(err error) bool {
+	return errors.Is(err, ErrUnauthenticated)
+}
+
+// ErrAccountNotFound is returned when the account does not exist (anymore).
+var ErrAccountNotFound = errors.New("argocd account not found")
+
+// IsAccountNotFound returns true if the error is due to the account not existing.
+func IsAccountNotFound(err error) bool {
+	return errors.Is(err, ErrAccountNotFound)
 }
 
 // TokenProviderOptions hold url, auth token for the API client.
@@ -44,12 +132,22 @@ type TokenProviderOptions struct {
 	UserAgent   string
 	AuthToken   string
 	DebugClient bool
+
+	// TLSConfig of the connections to Argo CD. (Default: Go defaults)
+	TLSConfig *tls.Config
+
+	// Relogin, if any, creates a new session to replace the rejected one.
+	// Requests rejected by Argo CD are then replayed once with it.
+	Relogin func(rejected string) (string, error)
 }
 
 // TokenProvider defines an interface for interaction with an Argo CD server.
 type TokenProvider interface {
 	CreateSession(username, password string) (string, error)
-	CreateTokenForAccount(name string) (string, error)
+	CreateTokenForAccount(name, id string, expiresIn int64) (string, error)
+	DeleteTokenForAccount(name, id string) error
+	GetAccount(name string) (*Account, error)
+	GetUserInfo() (*UserInfo, error)
 	SetAuthToken(token string)
 }
 
@@ -75,12 +173,62 @@ func NewTokenProvider(opts *TokenProviderOptions) (TokenProvider, error) {
 
 	res.httpClient = &http.Client{}
 	res.httpClient.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		TLSClientConfig: opts.TLSConfig,
+	}
+
+	if opts.Relogin != nil {
+		res.httpClient.Transport = &reloginTransport{
+			base: res.httpClient.Transport,
+			opts: opts,
+		}
 	}
 
 	return &res, nil
 }
 
+// A reloginTransport creates a new session when Argo CD rejects the session
+// token of a request (i.e. after a restart or a signing key change), then
+// replays the request once with the new session token.
+type reloginTransport struct {
+	base http.RoundTripper
+	opts *TokenProviderOptions
+}
+
+func (t *reloginTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	// Only authenticated requests whose body can be read again are replayed.
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") || (req.Body != nil && req.GetBody == nil) {
+		return res, nil
+	}
+
+	token, err := t.opts.Relogin(strings.TrimPrefix(auth, "Bearer "))
+	if err != nil {
+		res.Body.Close()
+		return nil, fmt.Errorf("renew argocd session failed: %w", err)
+	}
+	res.Body.Close()
+
+	// Later requests use the new session straight away.
+	t.opts.AuthToken = token
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	retry.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	return t.base.RoundTrip(retry)
+}
+
 type tokenProvider struct {
 	serverAddr  string
 	userAgent   string
@@ -143,10 +291,21 @@ func (tp *tokenProvider) CreateSession(user, pass string) (string, error) {
 	return response["token"], nil
 }
 
-func (tp *tokenProvider) CreateTokenForAccount(name string) (string, error) {
+func (tp *tokenProvider) CreateTokenForAccount(name, id string, expiresIn int64) (string, error) {
+	data := map[string]interface{}{
+		"name":      name,
+		"id":        id,
+		"expiresIn": expiresIn,
+	}
+
+	bin, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
 	url := fmt.Sprintf("%s/api/v1/account/%s/token", tp.serverAddr, name)
 
-	req, err := http.NewRequest(http.MethodPost, url, nil)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(bin))
 	if err != nil {
 		return "", err
 	}
@@ -184,6 +343,132 @@ func (tp *tokenProvider) CreateTokenForAccount(name string) (string, error) {
 	return response["token"], nil
 }
 
+func (tp *tokenProvider) DeleteTokenForAccount(name, id string) error {
+	url := fmt.Sprintf("%s/api/v1/account/%s/token/%s", tp.serverAddr, name, id)
+
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tp.authToken))
+
+	if tp.debugClient {
+		debug(httputil.DumpRequestOut(req, true))
+	}
+
+	res, err := tp.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if tp.debugClient {
+		debug(httputil.DumpResponse(res, true))
+	}
+
+	// The token has already been revoked.
+	if res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("delete argocd account token request failed: %s", res.Status)
+	}
+
+	return nil
+}
+
+func (tp *tokenProvider) GetAccount(name string) (*Account, error) {
+	url := fmt.Sprintf("%s/api/v1/account/%s", tp.serverAddr, name)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tp.authToken))
+
+	if tp.debugClient {
+		debug(httputil.DumpRequestOut(req, true))
+	}
+
+	res, err := tp.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if tp.debugClient {
+		debug(httputil.DumpResponse(res, true))
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrAccountNotFound
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get argocd account request failed: %s", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &Account{}
+	if err := json.Unmarshal(body, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (tp *tokenProvider) GetUserInfo() (*UserInfo, error) {
+	url := fmt.Sprintf("%s/api/v1/session/userinfo", tp.serverAddr)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tp.authToken))
+
+	if tp.debugClient {
+		debug(httputil.DumpRequestOut(req, true))
+	}
+
+	res, err := tp.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if tp.debugClient {
+		debug(httputil.DumpResponse(res, true))
+	}
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthenticated
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get argocd user info request failed: %s", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &UserInfo{}
+	if err := json.Unmarshal(body, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
 func debug(data []byte, err error) {
 	if err == nil {
 		fmt.Printf("%s\n\n", data)
@@ -0,0 +1,248 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// argocdServer accepts the requests authenticated with the valid session,
+// recording the ones it receives.
+type argocdServer struct {
+	mu      sync.Mutex
+	valid   string
+	auths   []string
+	bodies  []string
+	account *Account
+}
+
+func (s *argocdServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	s.mu.Lock()
+	auth := r.Header.Get("Authorization")
+	s.auths = append(s.auths, auth)
+	s.bodies = append(s.bodies, string(body))
+	valid := s.valid
+	s.mu.Unlock()
+
+	if auth != "Bearer "+valid {
+		http.Error(w, `{"error":"invalid session"}`, http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/account/"+s.account.Name:
+		json.NewEncoder(w).Encode(s.account)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/account/"+s.account.Name+"/token":
+		json.NewEncoder(w).Encode(map[string]string{"token": "minted"})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/session/userinfo":
+		json.NewEncoder(w).Encode(&UserInfo{LoggedIn: true, Username: "admin"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *argocdServer) requests() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.auths...), append([]string{}, s.bodies...)
+}
+
+// relogin returns a Relogin function handing out the specified session and
+// recording the rejected ones.
+func relogin(session string, err error, rejected *[]string) func(string) (string, error) {
+	return func(r string) (string, error) {
+		*rejected = append(*rejected, r)
+		return session, err
+	}
+}
+
+func TestReloginTransportReplaysOnce(t *testing.T) {
+	srv := &argocdServer{valid: "new", account: &Account{Name: "alice", Enabled: true}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	rejected := []string{}
+	opts := &TokenProviderOptions{
+		ServerUrl: ts.URL,
+		AuthToken: "old",
+		Relogin:   relogin("new", nil, &rejected),
+	}
+
+	acc, err := GetAccount(opts, "alice")
+	if err != nil {
+		t.Fatalf("GetAccount(...): unexpected error: %v", err)
+	}
+	if acc.Name != "alice" {
+		t.Errorf("GetAccount(...): want account alice, got %q", acc.Name)
+	}
+
+	if len(rejected) != 1 || rejected[0] != "old" {
+		t.Errorf("GetAccount(...): want the old session rejected once, got %v", rejected)
+	}
+
+	auths, _ := srv.requests()
+	if want := []string{"Bearer old", "Bearer new"}; strings.Join(auths, ",") != strings.Join(want, ",") {
+		t.Errorf("GetAccount(...): want requests authenticated with %v, got %v", want, auths)
+	}
+
+	// Later requests use the new session straight away.
+	if opts.AuthToken != "new" {
+		t.Errorf("GetAccount(...): want the options to hold the new session, got %q", opts.AuthToken)
+	}
+	if _, err := GetAccount(opts, "alice"); err != nil {
+		t.Fatalf("GetAccount(...): unexpected error: %v", err)
+	}
+	if len(rejected) != 1 {
+		t.Errorf("GetAccount(...): want no more renewals, got %v", rejected)
+	}
+}
+
+func TestReloginTransportReplaysBody(t *testing.T) {
+	srv := &argocdServer{valid: "new", account: &Account{Name: "alice"}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	rejected := []string{}
+	opts := &TokenProviderOptions{
+		ServerUrl: ts.URL,
+		AuthToken: "old",
+		Relogin:   relogin("new", nil, &rejected),
+	}
+
+	token, err := GenerateToken(opts, "alice", "ci", 3600)
+	if err != nil {
+		t.Fatalf("GenerateToken(...): unexpected error: %v", err)
+	}
+	if token != "minted" {
+		t.Errorf("GenerateToken(...): want token minted, got %q", token)
+	}
+
+	_, bodies := srv.requests()
+	if len(bodies) != 2 || bodies[0] != bodies[1] || len(bodies[1]) == 0 {
+		t.Errorf("GenerateToken(...): want the same body replayed, got %q", bodies)
+	}
+}
+
+func TestReloginTransportGivesUpAfterOneReplay(t *testing.T) {
+	// Argo CD rejects the new session too.
+	srv := &argocdServer{valid: "never", account: &Account{Name: "alice"}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	rejected := []string{}
+	opts := &TokenProviderOptions{
+		ServerUrl: ts.URL,
+		AuthToken: "old",
+		Relogin:   relogin("new", nil, &rejected),
+	}
+
+	if _, err := GetAccount(opts, "alice"); err == nil {
+		t.Fatalf("GetAccount(...): want error, got none")
+	}
+
+	if len(rejected) != 1 {
+		t.Errorf("GetAccount(...): want a single renewal, got %v", rejected)
+	}
+	if auths, _ := srv.requests(); len(auths) != 2 {
+		t.Errorf("GetAccount(...): want 2 requests, got %d", len(auths))
+	}
+}
+
+func TestReloginTransportReloginError(t *testing.T) {
+	srv := &argocdServer{valid: "new", account: &Account{Name: "alice"}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	boom := errors.New("bad credentials")
+	rejected := []string{}
+	opts := &TokenProviderOptions{
+		ServerUrl: ts.URL,
+		AuthToken: "old",
+		Relogin:   relogin("", boom, &rejected),
+	}
+
+	_, err := GetAccount(opts, "alice")
+	if !errors.Is(err, boom) {
+		t.Errorf("GetAccount(...): want error %v, got %v", boom, err)
+	}
+	if auths, _ := srv.requests(); len(auths) != 1 {
+		t.Errorf("GetAccount(...): want no replay, got %d requests", len(auths))
+	}
+}
+
+func TestReloginTransportSkipsUnreplayableRequests(t *testing.T) {
+	srv := &argocdServer{valid: "new", account: &Account{Name: "alice"}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	rejected := []string{}
+	opts := &TokenProviderOptions{
+		ServerUrl: ts.URL,
+		AuthToken: "old",
+		Relogin:   relogin("new", nil, &rejected),
+	}
+	tr := &reloginTransport{base: http.DefaultTransport, opts: opts}
+
+	cases := map[string]func() *http.Request{
+		// A body that cannot be read again.
+		"NoGetBody": func() *http.Request {
+			req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/account/alice/token", io.NopCloser(strings.NewReader("{}")))
+			req.Header.Set("Authorization", "Bearer old")
+			return req
+		},
+		// Not authenticated with a session, i.e. a login.
+		"NoSession": func() *http.Request {
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/account/alice", nil)
+			return req
+		},
+	}
+
+	for name, newReq := range cases {
+		t.Run(name, func(t *testing.T) {
+			rejected = rejected[:0]
+
+			res, err := tr.RoundTrip(newReq())
+			if err != nil {
+				t.Fatalf("RoundTrip(...): unexpected error: %v", err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != http.StatusUnauthorized {
+				t.Errorf("RoundTrip(...): want status %d, got %d", http.StatusUnauthorized, res.StatusCode)
+			}
+			if len(rejected) != 0 {
+				t.Errorf("RoundTrip(...): want no renewal, got %v", rejected)
+			}
+		})
+	}
+}
+
+func TestGetUserInfoDoesNotRelogin(t *testing.T) {
+	srv := &argocdServer{valid: "session", account: &Account{Name: "alice"}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	rejected := []string{}
+	opts := &TokenProviderOptions{
+		ServerUrl: ts.URL,
+		AuthToken: "session",
+		Relogin:   relogin("session", nil, &rejected),
+	}
+
+	// The stored token is not a session: its rejection is the answer.
+	_, err := GetUserInfo(opts, "stored")
+	if !IsUnauthenticated(err) {
+		t.Errorf("GetUserInfo(...): want unauthenticated error, got %v", err)
+	}
+	if len(rejected) != 0 {
+		t.Errorf("GetUserInfo(...): want no renewal, got %v", rejected)
+	}
+}
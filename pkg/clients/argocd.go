@@ -8,6 +8,8 @@ import (
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
@@ -19,6 +21,7 @@ import (
 
 const (
 	argocdInititalAdminSecret = "argocd-initial-admin-secret"
+	argocdAdminUsername       = "admin"
 )
 
 // GetConfig constructs a ClientOptions configuration that can be used to authenticate to argocd
@@ -44,28 +47,91 @@ func UseProviderConfig(ctx context.Context, k client.Client, mg resource.Managed
 		return nil, errors.Wrap(err, "cannot track ProviderConfig usage")
 	}
 
+	tlsConfig, err := GetTLSConfig(ctx, k, pc)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get TLS config")
+	}
+
 	opts := &accounts.TokenProviderOptions{
 		ServerUrl:   pc.Spec.ServerUrl,
 		UserAgent:   pc.Spec.UserAgent,
 		DebugClient: isBoolPtrEqualToBool(pc.Spec.DebugClient, true),
+		TLSConfig:   tlsConfig,
 	}
 
-	pass, err := GetInitialAdminPassword(ctx, k, pc)
-	if err != nil {
-		return nil, err
+	// No credentials at all, i.e. for test setups.
+	if creds := pc.Spec.Credentials; creds != nil && creds.Source == xpv1.CredentialsSourceNone {
+		return opts, nil
+	}
+
+	// Pre-issued API tokens are used as they are.
+	if creds := pc.Spec.Credentials; creds != nil && creds.Type == v1alpha1.CredentialsTypeToken {
+		token, err := GetInitialAdminPassword(ctx, k, pc)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.AuthToken = strings.TrimSpace(token)
+		return opts, nil
+	}
+
+	login := func() (string, error) {
+		user, err := GetUsername(ctx, k, pc)
+		if err != nil {
+			return "", err
+		}
+
+		pass, err := GetInitialAdminPassword(ctx, k, pc)
+		if err != nil {
+			return "", err
+		}
+
+		return accounts.Login(opts, user, pass)
 	}
 
-	token, err := accounts.Login(opts, "admin", pass)
+	token, err := sessions.Login(pc, login)
 	if err != nil {
 		return nil, err
 	}
 
 	opts.AuthToken = token
+	// Sessions may be rejected before they expire, i.e. when Argo CD restarts.
+	opts.Relogin = func(rejected string) (string, error) {
+		return sessions.Renew(pc, rejected, login)
+	}
 
 	return opts, nil
 }
 
-// GetInitialAdminPassword returns the ArgoCD initial admin password.
+// GetUsername returns the username of the account to log in with.
+func GetUsername(ctx context.Context, k client.Client, pc *v1alpha1.ProviderConfig) (string, error) {
+	creds := pc.Spec.Credentials
+	if creds == nil {
+		return argocdAdminUsername, nil
+	}
+
+	if ref := creds.UsernameSecretRef; ref != nil {
+		user, err := GetSecret(ctx, k, ref)
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot get %s username secret", ref.Name)
+		}
+
+		if user = strings.TrimSpace(user); len(user) == 0 {
+			return "", errors.Errorf("key %s is not found in referenced Kubernetes secret", ref.Key)
+		}
+
+		return user, nil
+	}
+
+	if user := strings.TrimSpace(creds.Username); len(user) > 0 {
+		return user, nil
+	}
+
+	return argocdAdminUsername, nil
+}
+
+// GetInitialAdminPassword returns the ArgoCD initial admin password, or
+// whatever credentials are referenced by the provider config.
 func GetInitialAdminPassword(ctx context.Context, k client.Client, pc *v1alpha1.ProviderConfig) (string, error) {
 	ref := &xpv1.SecretKeySelector{
 		SecretReference: xpv1.SecretReference{
@@ -74,11 +140,17 @@ func GetInitialAdminPassword(ctx context.Context, k client.Client, pc *v1alpha1.
 		Key: corev1.BasicAuthPasswordKey,
 	}
 
-	if pc.Spec.Credentials != nil {
-		if s := pc.Spec.Credentials.Source; s != xpv1.CredentialsSourceSecret {
-			return "", errors.Errorf("credentials source %s is not currently supported", s)
+	if creds := pc.Spec.Credentials; creds != nil && creds.Source != xpv1.CredentialsSourceSecret {
+		data, err := resource.CommonCredentialExtractor(ctx, creds.Source, k, creds.CommonCredentialSelectors)
+		if err != nil {
+			return "", errors.Wrap(err, "cannot extract credentials")
 		}
 
+		// Files and environment variables often end with a newline.
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	if pc.Spec.Credentials != nil {
 		csr := pc.Spec.Credentials.SecretRef
 		if csr != nil {
 			if name := strings.TrimSpace(csr.SecretReference.Name); len(name) > 0 {
@@ -119,3 +191,28 @@ func isBoolPtrEqualToBool(bp *bool, b bool) bool {
 
 	return (*bp == b)
 }
+
+// IsNamespaceAllowed returns true if the namespace is listed or selected by
+// the allowed namespaces. Any namespace is allowed if none is specified.
+func IsNamespaceAllowed(ns *corev1.Namespace, allowed *v1alpha1.AllowedNamespaces) (bool, error) {
+	if allowed == nil {
+		return true, nil
+	}
+
+	for _, name := range allowed.Names {
+		if name == ns.GetName() {
+			return true, nil
+		}
+	}
+
+	if allowed.Selector == nil {
+		return false, nil
+	}
+
+	sel, err := metav1.LabelSelectorAsSelector(allowed.Selector)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot parse allowed namespaces selector")
+	}
+
+	return sel.Matches(labels.Set(ns.GetLabels())), nil
+}
@@ -0,0 +1,98 @@
+package clients
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+)
+
+// clusterTimeout bounds every request to a remote cluster, so an unreachable
+// cluster does not stall the reconciliation.
+const clusterTimeout = 10 * time.Second
+
+// clusterClients caches the clients of the remote clusters, since building
+// one discovers the whole cluster API.
+var clusterClients = &clusterClientCache{entries: map[string]*clusterClient{}}
+
+// A clusterClientCache caches a client per kubeconfig secret key.
+type clusterClientCache struct {
+	mu      sync.Mutex
+	entries map[string]*clusterClient
+}
+
+// A clusterClient is the client built from a kubeconfig secret version.
+type clusterClient struct {
+	resourceVersion string
+	client          client.Client
+}
+
+// NewClusterClient returns a client for the cluster described by the
+// kubeconfig stored in the referenced secret. Clients are cached until the
+// secret changes.
+func NewClusterClient(ctx context.Context, k client.Client, ref *xpv1.SecretKeySelector) (client.Client, error) {
+	s := &corev1.Secret{}
+	if err := k.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, s); err != nil {
+		return nil, errors.Wrapf(err, "cannot get %s kubeconfig secret", ref.Name)
+	}
+
+	key := string(s.GetUID()) + "/" + ref.Key
+
+	// Clients are built without holding the lock, so that an unreachable
+	// cluster does not hold up the others.
+	clusterClients.mu.Lock()
+	c, ok := clusterClients.entries[key]
+	clusterClients.mu.Unlock()
+	if ok && c.resourceVersion == s.GetResourceVersion() {
+		return c.client, nil
+	}
+
+	kubeconfig := s.Data[ref.Key]
+	if len(kubeconfig) == 0 {
+		return nil, errors.Errorf("key %s is not found in referenced Kubernetes secret", ref.Key)
+	}
+
+	rc, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse kubeconfig")
+	}
+	rc.Timeout = clusterTimeout
+
+	// Creating the client discovers the cluster API, thus failing if
+	// the cluster cannot be reached.
+	cli, err := client.New(rc, client.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	clusterClients.mu.Lock()
+	clusterClients.entries[key] = &clusterClient{resourceVersion: s.GetResourceVersion(), client: cli}
+	clusterClients.mu.Unlock()
+
+	return cli, nil
+}
+
+// IsClusterUnreachable returns true if the error tells that the cluster could
+// not be reached at all, as opposed to the cluster refusing the request.
+func IsClusterUnreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
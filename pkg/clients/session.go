@@ -0,0 +1,119 @@
+package clients
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/krateoplatformops/provider-argocd-token/apis/v1alpha1"
+	"github.com/krateoplatformops/provider-argocd-token/pkg/clients/accounts"
+)
+
+// sessionRenewBefore is how long before their expiration cached sessions
+// are renewed.
+const sessionRenewBefore = 5 * time.Minute
+
+// sessions caches the Argo CD sessions of the provider configs.
+var sessions = &sessionCache{entries: map[types.UID]*session{}}
+
+// A sessionCache caches a session per provider config, so that Argo CD is
+// not logged in to on every reconcile.
+type sessionCache struct {
+	mu      sync.Mutex
+	entries map[types.UID]*session
+}
+
+// A session is the last session created for a provider config.
+type session struct {
+	// mu serializes the logins for the provider config, so that concurrent
+	// logins collapse into one.
+	mu sync.Mutex
+
+	// resourceVersion of the provider config the session was created with.
+	resourceVersion string
+	token           string
+	// expiresAt is zero if the session never expires.
+	expiresAt time.Time
+}
+
+// Login returns the cached session of the provider config, or the one
+// created with login if there is none, the provider config changed since
+// or the session is about to expire.
+func (c *sessionCache) Login(pc *v1alpha1.ProviderConfig, login func() (string, error)) (string, error) {
+	s := c.session(pc.GetUID())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.valid(pc.GetResourceVersion(), time.Now()) {
+		return s.token, nil
+	}
+
+	return s.login(pc.GetResourceVersion(), login)
+}
+
+// Renew replaces the rejected session of the provider config with the one
+// created with login. The cached session is returned instead if it already
+// replaced the rejected one.
+func (c *sessionCache) Renew(pc *v1alpha1.ProviderConfig, rejected string, login func() (string, error)) (string, error) {
+	s := c.session(pc.GetUID())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != rejected && s.valid(pc.GetResourceVersion(), time.Now()) {
+		return s.token, nil
+	}
+
+	return s.login(pc.GetResourceVersion(), login)
+}
+
+func (c *sessionCache) session(uid types.UID) *session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.entries[uid]
+	if !ok {
+		s = &session{}
+		c.entries[uid] = s
+	}
+
+	return s
+}
+
+// login replaces the session with the one created with login. The caller
+// must hold the session lock.
+func (s *session) login(resourceVersion string, login func() (string, error)) (string, error) {
+	s.token = ""
+
+	token, err := login()
+	if err != nil {
+		return "", err
+	}
+
+	s.resourceVersion = resourceVersion
+	s.token = token
+	s.expiresAt = time.Time{}
+
+	// Sessions we cannot tell the expiration of are not reused.
+	claims, err := accounts.ParseClaims(token)
+	switch {
+	case err != nil:
+		s.token = ""
+	case claims.ExpiresAt > 0:
+		s.expiresAt = time.Unix(claims.ExpiresAt, 0)
+	}
+
+	return token, nil
+}
+
+// valid returns true if the session can be reused with the specified
+// provider config version at the specified time.
+func (s *session) valid(resourceVersion string, now time.Time) bool {
+	if len(s.token) == 0 || s.resourceVersion != resourceVersion {
+		return false
+	}
+
+	return s.expiresAt.IsZero() || now.Add(sessionRenewBefore).Before(s.expiresAt)
+}
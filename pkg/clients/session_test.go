@@ -0,0 +1,237 @@
+package clients
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/krateoplatformops/provider-argocd-token/apis/v1alpha1"
+	"github.com/krateoplatformops/provider-argocd-token/pkg/clients/accounts"
+)
+
+// fakeJWT returns an unsigned token with the specified claims.
+func fakeJWT(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+
+	bin, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString(bin) + ".sig"
+}
+
+// sessionServer serves Argo CD sessions expiring in an hour, counting the
+// logins.
+func sessionServer(t *testing.T, logins *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/session" {
+			http.NotFound(w, r)
+			return
+		}
+
+		n := atomic.AddInt32(logins, 1)
+		// Give concurrent logins time to pile up.
+		time.Sleep(50 * time.Millisecond)
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"token": fakeJWT(t, map[string]interface{}{
+				"jti": fmt.Sprintf("session-%d", n),
+				"exp": time.Now().Add(time.Hour).Unix(),
+			}),
+		})
+	}))
+}
+
+func newProviderConfig(uid, resourceVersion string) *v1alpha1.ProviderConfig {
+	return &v1alpha1.ProviderConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "argocd",
+			UID:             types.UID(uid),
+			ResourceVersion: resourceVersion,
+		},
+	}
+}
+
+func TestSessionCacheLoginCollapsesConcurrentLogins(t *testing.T) {
+	var logins int32
+	srv := sessionServer(t, &logins)
+	defer srv.Close()
+
+	c := &sessionCache{entries: map[types.UID]*session{}}
+	pc := newProviderConfig("pc-1", "1")
+	opts := &accounts.TokenProviderOptions{ServerUrl: srv.URL}
+
+	const n = 10
+	tokens := make([]string, n)
+	errs := make([]error, n)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = c.Login(pc, func() (string, error) {
+				return accounts.Login(opts, "admin", "secret")
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("Login(...): unexpected error: %v", errs[i])
+		}
+		if tokens[i] != tokens[0] {
+			t.Errorf("Login(...): got different sessions %q and %q", tokens[i], tokens[0])
+		}
+	}
+
+	if got := atomic.LoadInt32(&logins); got != 1 {
+		t.Errorf("Login(...): want 1 login, got %d", got)
+	}
+}
+
+func TestSessionCacheLoginRenews(t *testing.T) {
+	cases := map[string]struct {
+		claims          map[string]interface{}
+		resourceVersion string
+		wantLogins      int
+	}{
+		"ReuseValidSession": {
+			claims:          map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()},
+			resourceVersion: "1",
+			wantLogins:      1,
+		},
+		"ReuseSessionWithoutExpiration": {
+			claims:          map[string]interface{}{"sub": "admin"},
+			resourceVersion: "1",
+			wantLogins:      1,
+		},
+		"RenewExpiringSession": {
+			claims:          map[string]interface{}{"exp": time.Now().Add(time.Minute).Unix()},
+			resourceVersion: "1",
+			wantLogins:      2,
+		},
+		"RenewOnProviderConfigChange": {
+			claims:          map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()},
+			resourceVersion: "2",
+			wantLogins:      2,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &sessionCache{entries: map[types.UID]*session{}}
+
+			logins := 0
+			login := func() (string, error) {
+				logins++
+				return fakeJWT(t, tc.claims), nil
+			}
+
+			if _, err := c.Login(newProviderConfig("pc-1", "1"), login); err != nil {
+				t.Fatalf("Login(...): unexpected error: %v", err)
+			}
+			if _, err := c.Login(newProviderConfig("pc-1", tc.resourceVersion), login); err != nil {
+				t.Fatalf("Login(...): unexpected error: %v", err)
+			}
+
+			if logins != tc.wantLogins {
+				t.Errorf("Login(...): want %d logins, got %d", tc.wantLogins, logins)
+			}
+		})
+	}
+}
+
+func TestSessionCacheRenew(t *testing.T) {
+	var logins int32
+	srv := sessionServer(t, &logins)
+	defer srv.Close()
+
+	c := &sessionCache{entries: map[types.UID]*session{}}
+	pc := newProviderConfig("pc-1", "1")
+	opts := &accounts.TokenProviderOptions{ServerUrl: srv.URL}
+	login := func() (string, error) {
+		return accounts.Login(opts, "admin", "secret")
+	}
+
+	first, err := c.Login(pc, login)
+	if err != nil {
+		t.Fatalf("Login(...): unexpected error: %v", err)
+	}
+
+	// The cached session is the rejected one: log in again.
+	second, err := c.Renew(pc, first, login)
+	if err != nil {
+		t.Fatalf("Renew(...): unexpected error: %v", err)
+	}
+	if second == first {
+		t.Errorf("Renew(...): want a new session, got the rejected one")
+	}
+	if got := atomic.LoadInt32(&logins); got != 2 {
+		t.Errorf("Renew(...): want 2 logins, got %d", got)
+	}
+
+	// The rejected session has already been replaced, i.e. by a concurrent
+	// renewal: reuse the replacement.
+	third, err := c.Renew(pc, first, login)
+	if err != nil {
+		t.Fatalf("Renew(...): unexpected error: %v", err)
+	}
+	if third != second {
+		t.Errorf("Renew(...): want the cached session %q, got %q", second, third)
+	}
+	if got := atomic.LoadInt32(&logins); got != 2 {
+		t.Errorf("Renew(...): want no more logins, got %d", got)
+	}
+
+	// Once cached, the new session is what Login returns.
+	if cur, _ := c.Login(pc, login); cur != second {
+		t.Errorf("Login(...): want the renewed session %q, got %q", second, cur)
+	}
+}
+
+func TestSessionCacheRenewCollapsesConcurrentRenewals(t *testing.T) {
+	var logins int32
+	srv := sessionServer(t, &logins)
+	defer srv.Close()
+
+	c := &sessionCache{entries: map[types.UID]*session{}}
+	pc := newProviderConfig("pc-1", "1")
+	opts := &accounts.TokenProviderOptions{ServerUrl: srv.URL}
+	login := func() (string, error) {
+		return accounts.Login(opts, "admin", "secret")
+	}
+
+	rejected, err := c.Login(pc, login)
+	if err != nil {
+		t.Fatalf("Login(...): unexpected error: %v", err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Renew(pc, rejected, login); err != nil {
+				t.Errorf("Renew(...): unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&logins); got != 2 {
+		t.Errorf("Renew(...): want 2 logins, got %d", got)
+	}
+}
@@ -1,8 +1,8 @@
 package clients
 
 import (
+	"bytes"
 	"context"
-	"net/http"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
@@ -13,16 +13,185 @@ import (
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 )
 
+// SecretOptions tune how secrets are written.
+type SecretOptions struct {
+	// OwnerLabels identify the secrets owned by the writer; they are set on
+	// every written secret.
+	OwnerLabels map[string]string
+
+	// Adopt existing secrets that are not owned yet, keeping their values.
+	Adopt bool
+
+	// Overwrite existing secrets that are not owned yet, dropping their values.
+	Overwrite bool
+
+	// ClaimUnlabeled secrets, carrying none of the owner labels, as owned:
+	// i.e. the secrets written before the owner labels were introduced.
+	ClaimUnlabeled bool
+
+	// Labels and Annotations set on every written secret.
+	Labels      map[string]string
+	Annotations map[string]string
+
+	// Type of the written secrets. (Default: Opaque)
+	Type corev1.SecretType
+
+	// Immutable marks the written secrets as immutable. Since their values
+	// cannot be updated, they are replaced instead.
+	Immutable bool
+}
+
+// IsOwned returns true if the secret carries all the owner labels, or none
+// of them when unlabeled secrets are claimed.
+func (o SecretOptions) IsOwned(s *corev1.Secret) bool {
+	if o.hasOwnerLabels(s) {
+		return true
+	}
+	if !o.ClaimUnlabeled {
+		return false
+	}
+
+	for k := range o.OwnerLabels {
+		if _, ok := s.GetLabels()[k]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (o SecretOptions) hasOwnerLabels(s *corev1.Secret) bool {
+	for k, v := range o.OwnerLabels {
+		if s.GetLabels()[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// IsUpToDate returns true if the secret carries the labels, annotations,
+// type and immutability defined by the options.
+func (o SecretOptions) IsUpToDate(s *corev1.Secret) bool {
+	for k, v := range o.Labels {
+		if s.GetLabels()[k] != v {
+			return false
+		}
+	}
+	for k, v := range o.Annotations {
+		if s.GetAnnotations()[k] != v {
+			return false
+		}
+	}
+	return s.Type == o.secretType() &&
+		IsBoolPtrEqualToBool(s.Immutable, true) == o.Immutable &&
+		o.hasOwnerLabels(s)
+}
+
+func (o SecretOptions) secretType() corev1.SecretType {
+	if len(o.Type) == 0 {
+		return corev1.SecretTypeOpaque
+	}
+	return o.Type
+}
+
 func SetSecret(ctx context.Context, k client.Client, ref *xpv1.SecretKeySelector, val string) error {
 	if ref == nil {
 		return errors.New("no credentials secret referenced")
 	}
 
-	s := &corev1.Secret{}
-	s.Name = ref.Name
-	s.Namespace = ref.Namespace
-	s.StringData = map[string]string{
+	return SetSecretValues(ctx, k, &ref.SecretReference, map[string]string{
 		ref.Key: val,
+	}, SecretOptions{})
+}
+
+// SetSecretValues creates or updates the referenced secret with the specified
+// values. Keys with an empty value are removed from the secret. Secrets whose
+// type or immutable values have to change are replaced.
+func SetSecretValues(ctx context.Context, k client.Client, ref *xpv1.SecretReference, vals map[string]string, opts SecretOptions) error {
+	if ref == nil {
+		return errors.New("no credentials secret referenced")
+	}
+
+	s := &corev1.Secret{}
+	err := k.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, s)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	exists := err == nil
+	if !exists {
+		s.Name = ref.Name
+		s.Namespace = ref.Namespace
+	}
+
+	if s.Labels == nil {
+		s.Labels = map[string]string{}
+	}
+	if s.Data == nil {
+		s.Data = map[string][]byte{}
+	}
+
+	old := make(map[string][]byte, len(s.Data))
+	for key, val := range s.Data {
+		old[key] = val
+	}
+
+	if exists && !opts.IsOwned(s) {
+		switch {
+		case opts.Overwrite:
+			s.Data = map[string][]byte{}
+		case !opts.Adopt:
+			return errors.Errorf("secret %s/%s already exists and is not owned by this resource", ref.Namespace, ref.Name)
+		}
+	}
+
+	if s.Annotations == nil && len(opts.Annotations) > 0 {
+		s.Annotations = map[string]string{}
+	}
+	for key, val := range opts.Annotations {
+		s.Annotations[key] = val
+	}
+
+	for key, val := range opts.Labels {
+		s.Labels[key] = val
+	}
+	for key, val := range opts.OwnerLabels {
+		s.Labels[key] = val
+	}
+
+	for key, val := range vals {
+		if len(val) > 0 {
+			s.Data[key] = []byte(val)
+		} else {
+			delete(s.Data, key)
+		}
+	}
+
+	// Neither the type nor the values of an immutable secret can be updated.
+	immutable := IsBoolPtrEqualToBool(s.Immutable, true)
+	replace := s.Type != opts.secretType() ||
+		(immutable && (!opts.Immutable || !EqualData(old, s.Data)))
+
+	s.Type = opts.secretType()
+	s.Immutable = nil
+	if opts.Immutable {
+		s.Immutable = &opts.Immutable
+	}
+
+	if exists && !replace {
+		return k.Update(ctx, s)
+	}
+
+	if exists {
+		if err := k.Delete(ctx, s); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		s.ResourceVersion = ""
+		s.UID = ""
+	}
+
+	// Nothing to write.
+	if len(s.Data) == 0 {
+		return nil
 	}
 
 	return k.Create(ctx, s)
@@ -41,6 +210,48 @@ func GetSecret(ctx context.Context, k client.Client, ref *xpv1.SecretKeySelector
 	return string(s.Data[ref.Key]), nil
 }
 
+// GetOwnedSecret returns the value of the referenced key only if the secret
+// is owned according to the specified options; empty otherwise.
+func GetOwnedSecret(ctx context.Context, k client.Client, ref *xpv1.SecretKeySelector, opts SecretOptions) (string, error) {
+	if ref == nil {
+		return "", errors.New("no credentials secret referenced")
+	}
+
+	s := &corev1.Secret{}
+	if err := k.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, s); err != nil {
+		return "", err
+	}
+
+	if !opts.IsOwned(s) {
+		return "", nil
+	}
+
+	return string(s.Data[ref.Key]), nil
+}
+
+// ListOwnedSecrets returns the secrets with the specified name that are owned
+// according to the specified options, in the specified namespace or in any
+// namespace if empty.
+func ListOwnedSecrets(ctx context.Context, k client.Client, namespace, name string, opts SecretOptions) ([]corev1.Secret, error) {
+	if len(opts.OwnerLabels) == 0 {
+		return nil, errors.New("no owner labels specified")
+	}
+
+	list := &corev1.SecretList{}
+	if err := k.List(ctx, list, client.InNamespace(namespace), client.MatchingLabels(opts.OwnerLabels)); err != nil {
+		return nil, err
+	}
+
+	res := []corev1.Secret{}
+	for _, s := range list.Items {
+		if s.GetName() == name {
+			res = append(res, s)
+		}
+	}
+
+	return res, nil
+}
+
 func DeleteSecret(ctx context.Context, k client.Client, ref *xpv1.SecretKeySelector) error {
 	if ref == nil {
 		return errors.New("no credentials secret referenced")
@@ -53,9 +264,41 @@ func DeleteSecret(ctx context.Context, k client.Client, ref *xpv1.SecretKeySelec
 	return k.Delete(ctx, s)
 }
 
+// DeleteOwnedSecret deletes the referenced secret only if it is owned
+// according to the specified options.
+func DeleteOwnedSecret(ctx context.Context, k client.Client, ref *xpv1.SecretReference, opts SecretOptions) error {
+	if ref == nil {
+		return errors.New("no credentials secret referenced")
+	}
+
+	s := &corev1.Secret{}
+	if err := k.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, s); err != nil {
+		return err
+	}
+
+	if !opts.IsOwned(s) {
+		return nil
+	}
+
+	return k.Delete(ctx, s)
+}
+
+// EqualData returns true if both secret data hold the same values.
+func EqualData(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		w, ok := b[k]
+		if !ok || !bytes.Equal(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
 func ErrorIsNotFound(err error) bool {
-	ex, ok := err.(*apierrors.StatusError)
-	return ok || (ex.Status().Code == http.StatusNotFound)
+	return apierrors.IsNotFound(err)
 }
 
 // IsBoolPtrEqualToBool compares a *bool with bool
@@ -0,0 +1,190 @@
+package clients
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+)
+
+// A recordingClient records the writes made through it.
+type recordingClient struct {
+	client.Client
+	calls []string
+}
+
+func (c *recordingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.calls = append(c.calls, "create")
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *recordingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.calls = append(c.calls, "update")
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *recordingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.calls = append(c.calls, "delete")
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func newSecret(labels map[string]string, immutable bool, data map[string]string) *corev1.Secret {
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ci-token", Namespace: "default", Labels: labels},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{},
+	}
+	if immutable {
+		s.Immutable = &immutable
+	}
+	for k, v := range data {
+		s.Data[k] = []byte(v)
+	}
+	return s
+}
+
+func TestSetSecretValues(t *testing.T) {
+	owner := map[string]string{"argocd.krateo.io/token": "ci"}
+	other := map[string]string{"argocd.krateo.io/token": "other"}
+
+	cases := map[string]struct {
+		cur       *corev1.Secret
+		vals      map[string]string
+		opts      SecretOptions
+		wantErr   bool
+		wantCalls []string
+		wantData  map[string]string
+	}{
+		"CreateMissing": {
+			vals:      map[string]string{"token": "new"},
+			opts:      SecretOptions{OwnerLabels: owner},
+			wantCalls: []string{"create"},
+			wantData:  map[string]string{"token": "new"},
+		},
+		"NothingToCreate": {
+			opts: SecretOptions{OwnerLabels: owner},
+		},
+		"UpdateOwned": {
+			cur:       newSecret(owner, false, map[string]string{"token": "old", "previousToken": "older", "extra": "kept"}),
+			vals:      map[string]string{"token": "new", "previousToken": ""},
+			opts:      SecretOptions{OwnerLabels: owner},
+			wantCalls: []string{"update"},
+			wantData:  map[string]string{"token": "new", "extra": "kept"},
+		},
+		"RefuseUnowned": {
+			cur:      newSecret(nil, false, map[string]string{"token": "theirs"}),
+			vals:     map[string]string{"token": "new"},
+			opts:     SecretOptions{OwnerLabels: owner},
+			wantErr:  true,
+			wantData: map[string]string{"token": "theirs"},
+		},
+		"AdoptUnowned": {
+			cur:       newSecret(nil, false, map[string]string{"token": "theirs", "extra": "kept"}),
+			vals:      map[string]string{"token": "new"},
+			opts:      SecretOptions{OwnerLabels: owner, Adopt: true},
+			wantCalls: []string{"update"},
+			wantData:  map[string]string{"token": "new", "extra": "kept"},
+		},
+		"OverwriteUnowned": {
+			cur:       newSecret(nil, false, map[string]string{"token": "theirs", "extra": "dropped"}),
+			vals:      map[string]string{"token": "new"},
+			opts:      SecretOptions{OwnerLabels: owner, Overwrite: true},
+			wantCalls: []string{"update"},
+			wantData:  map[string]string{"token": "new"},
+		},
+		"ClaimUnlabeled": {
+			cur:       newSecret(nil, false, map[string]string{"token": "old"}),
+			vals:      map[string]string{"token": "new"},
+			opts:      SecretOptions{OwnerLabels: owner, ClaimUnlabeled: true},
+			wantCalls: []string{"update"},
+			wantData:  map[string]string{"token": "new"},
+		},
+		"NeverClaimOtherOwners": {
+			cur:      newSecret(other, false, map[string]string{"token": "theirs"}),
+			vals:     map[string]string{"token": "new"},
+			opts:     SecretOptions{OwnerLabels: owner, ClaimUnlabeled: true},
+			wantErr:  true,
+			wantData: map[string]string{"token": "theirs"},
+		},
+		"ReplaceImmutable": {
+			cur:       newSecret(owner, true, map[string]string{"token": "old"}),
+			vals:      map[string]string{"token": "new"},
+			opts:      SecretOptions{OwnerLabels: owner, Immutable: true},
+			wantCalls: []string{"delete", "create"},
+			wantData:  map[string]string{"token": "new"},
+		},
+		"UpdateUnchangedImmutable": {
+			cur:       newSecret(owner, true, map[string]string{"token": "old"}),
+			vals:      map[string]string{"token": "old"},
+			opts:      SecretOptions{OwnerLabels: owner, Immutable: true},
+			wantCalls: []string{"update"},
+			wantData:  map[string]string{"token": "old"},
+		},
+		"ReplaceOnTypeChange": {
+			cur:       newSecret(owner, false, map[string]string{"token": "old"}),
+			vals:      map[string]string{"token": "new"},
+			opts:      SecretOptions{OwnerLabels: owner, Type: "argocd.krateo.io/token"},
+			wantCalls: []string{"delete", "create"},
+			wantData:  map[string]string{"token": "new"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := fake.NewClientBuilder()
+			if tc.cur != nil {
+				b = b.WithObjects(tc.cur)
+			}
+			k := &recordingClient{Client: b.Build()}
+
+			ref := &xpv1.SecretReference{Name: "ci-token", Namespace: "default"}
+			err := SetSecretValues(context.Background(), k, ref, tc.vals, tc.opts)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("SetSecretValues(...): want error %t, got %v", tc.wantErr, err)
+			}
+
+			if got, want := strings.Join(k.calls, ","), strings.Join(tc.wantCalls, ","); got != want {
+				t.Errorf("SetSecretValues(...): want calls %q, got %q", want, got)
+			}
+
+			s := &corev1.Secret{}
+			err = k.Get(context.Background(), types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, s)
+			if tc.wantData == nil {
+				if err == nil {
+					t.Errorf("SetSecretValues(...): want no secret, got %v", s.Data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get(...): unexpected error: %v", err)
+			}
+
+			got := map[string]string{}
+			for k, v := range s.Data {
+				got[k] = string(v)
+			}
+			if !EqualData(s.Data, toData(tc.wantData)) {
+				t.Errorf("SetSecretValues(...): want data %v, got %v", tc.wantData, got)
+			}
+
+			if !tc.wantErr && !tc.opts.IsUpToDate(s) {
+				t.Errorf("SetSecretValues(...): want secret up to date with the options, got labels %v, type %s", s.GetLabels(), s.Type)
+			}
+		})
+	}
+}
+
+func toData(vals map[string]string) map[string][]byte {
+	res := map[string][]byte{}
+	for k, v := range vals {
+		res[k] = []byte(v)
+	}
+	return res
+}
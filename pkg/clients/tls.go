@@ -0,0 +1,92 @@
+package clients
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/krateoplatformops/provider-argocd-token/apis/v1alpha1"
+)
+
+// tlsVersions maps the TLS versions of the API to the crypto/tls ones.
+var tlsVersions = map[v1alpha1.TLSVersion]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// GetTLSConfig returns the TLS configuration of the connections to argocd.
+func GetTLSConfig(ctx context.Context, k client.Client, pc *v1alpha1.ProviderConfig) (*tls.Config, error) {
+	res := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	cfg := pc.Spec.TLS
+	if cfg == nil {
+		return res, nil
+	}
+
+	res.ServerName = cfg.ServerName
+	res.InsecureSkipVerify = cfg.InsecureSkipVerify
+
+	if len(cfg.MinVersion) > 0 {
+		v, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, errors.Errorf("unsupported TLS version %s", cfg.MinVersion)
+		}
+		res.MinVersion = v
+	}
+
+	var ca string
+	switch {
+	case cfg.CABundleSecretRef != nil:
+		ref := cfg.CABundleSecretRef
+
+		val, err := GetSecret(ctx, k, ref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get %s CA bundle secret", ref.Name)
+		}
+		if len(val) == 0 {
+			return nil, errors.Errorf("key %s is not found in referenced Kubernetes secret", ref.Key)
+		}
+		ca = val
+	case cfg.CABundleConfigMapRef != nil:
+		ref := cfg.CABundleConfigMapRef
+
+		cm := &corev1.ConfigMap{}
+		if err := k.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, cm); err != nil {
+			return nil, errors.Wrapf(err, "cannot get %s CA bundle config map", ref.Name)
+		}
+		val, ok := cm.Data[ref.Key]
+		if !ok {
+			return nil, errors.Errorf("key %s is not found in referenced Kubernetes config map", ref.Key)
+		}
+		ca = val
+	}
+
+	if len(ca) > 0 {
+		res.RootCAs = x509.NewCertPool()
+		if !res.RootCAs.AppendCertsFromPEM([]byte(ca)) {
+			return nil, errors.New("cannot parse CA bundle: no PEM encoded certificate found")
+		}
+	}
+
+	if ref := cfg.ClientCertSecretRef; ref != nil {
+		s := &corev1.Secret{}
+		if err := k.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, s); err != nil {
+			return nil, errors.Wrapf(err, "cannot get %s client certificate secret", ref.Name)
+		}
+
+		cert, err := tls.X509KeyPair(s.Data[corev1.TLSCertKey], s.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot parse client certificate")
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+
+	return res, nil
+}
@@ -14,6 +14,7 @@ func Setup(mgr ctrl.Manager, o controller.Options) error {
 	for _, setup := range []func(ctrl.Manager, controller.Options) error{
 		config.Setup,
 		token.Setup,
+		token.SetupNamespaced,
 	} {
 		if err := setup(mgr, o); err != nil {
 			return err
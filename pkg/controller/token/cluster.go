@@ -0,0 +1,57 @@
+package token
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	tokensv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/tokens/v1alpha1"
+	"github.com/krateoplatformops/provider-argocd-token/pkg/clients"
+)
+
+// A reachabilityClient reports whether the remote cluster the token secrets
+// are written to can be reached, as told by the outcome of every request.
+// Cached clients are no proof of it.
+type reachabilityClient struct {
+	client.Client
+	cr resource.Managed
+}
+
+func (c *reachabilityClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	return c.observe(c.Client.Get(ctx, key, obj))
+}
+
+func (c *reachabilityClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return c.observe(c.Client.List(ctx, list, opts...))
+}
+
+func (c *reachabilityClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	return c.observe(c.Client.Create(ctx, obj, opts...))
+}
+
+func (c *reachabilityClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return c.observe(c.Client.Update(ctx, obj, opts...))
+}
+
+func (c *reachabilityClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.observe(c.Client.Patch(ctx, obj, patch, opts...))
+}
+
+func (c *reachabilityClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	return c.observe(c.Client.Delete(ctx, obj, opts...))
+}
+
+// observe sets the reachability of the cluster according to the request
+// error, which is returned as is. Errors returned by the cluster itself tell
+// it has been reached.
+func (c *reachabilityClient) observe(err error) error {
+	if clients.IsClusterUnreachable(err) {
+		c.cr.SetConditions(tokensv1alpha1.ClusterUnreachable(err.Error()))
+		return err
+	}
+
+	c.cr.SetConditions(tokensv1alpha1.ClusterReachable())
+	return err
+}
@@ -0,0 +1,249 @@
+package token
+
+import (
+	"context"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	tokensv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/tokens/v1alpha1"
+	apisv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/v1alpha1"
+	"github.com/krateoplatformops/provider-argocd-token/pkg/clients"
+)
+
+const (
+	errGetNamespace      = "cannot get namespace"
+	errNamespaceSelector = "cannot parse namespace selector"
+	errListNamespaces    = "cannot list namespaces"
+	errListSecretCopies  = "cannot list token secret copies"
+	errCopySecret        = "cannot copy token secret"
+	errDeleteSecretCopy  = "cannot delete token secret copy"
+
+	errFmtNamespaceNotAllowed = "namespace %s is not allowed by the %s provider config"
+)
+
+// checkSecretNamespace returns an error if the provider config does not allow
+// writing the token secret into its namespace.
+func (e *external) checkSecretNamespace(ctx context.Context, cr tokenResource) error {
+	if e.allowed == nil {
+		return nil
+	}
+
+	name := cr.GetTokenParameters().WriteTokenSecretToRef.Namespace
+
+	ok, err := namespaceAllowed(ctx, e.secrets, name, e.allowed)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Errorf(errFmtNamespaceNotAllowed, name, cr.GetProviderConfigReference().Name)
+	}
+
+	return nil
+}
+
+// namespaceAllowed returns true if the allowed namespaces include the named
+// namespace. Missing namespaces are matched by name only.
+func namespaceAllowed(ctx context.Context, k client.Client, name string, allowed *apisv1alpha1.AllowedNamespaces) (bool, error) {
+	if allowed == nil {
+		return true, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := k.Get(ctx, types.NamespacedName{Name: name}, ns); client.IgnoreNotFound(err) != nil {
+		return false, errors.Wrap(err, errGetNamespace)
+	}
+	ns.SetName(name)
+
+	return clients.IsNamespaceAllowed(ns, allowed)
+}
+
+// syncSecrets keeps the token secret metadata as specified and a copy of the
+// token secret in every selected namespace, removing the copies from the
+// namespaces no longer selected. Nothing is changed unless apply is set.
+// It returns true if the secrets were already in sync.
+func (e *external) syncSecrets(ctx context.Context, cr tokenResource, apply bool) (bool, error) {
+	ref := cr.GetTokenParameters().WriteTokenSecretToRef
+	opts := secretOptions(cr)
+
+	src := &corev1.Secret{}
+	if err := e.secrets.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, src); err != nil {
+		return false, err
+	}
+
+	want, err := e.copyNamespaces(ctx, cr)
+	if err != nil {
+		return false, err
+	}
+
+	have, err := e.secretCopies(ctx, cr)
+	if err != nil {
+		return false, err
+	}
+
+	inSync := opts.IsUpToDate(src)
+	if !inSync && apply {
+		err := clients.SetSecretValues(ctx, e.secrets, &ref.SecretReference, nil, opts)
+		if err != nil {
+			return false, err
+		}
+		e.log.Debug("Updated token secret metadata", "secret", ref.Name, "namespace", ref.Namespace)
+	}
+
+	for ns := range want {
+		cur, ok := have[ns]
+		if ok && opts.IsUpToDate(cur) && clients.EqualData(cur.Data, src.Data) {
+			continue
+		}
+
+		inSync = false
+		if !apply {
+			continue
+		}
+
+		vals := map[string]string{}
+		if ok {
+			for k := range cur.Data {
+				vals[k] = ""
+			}
+		}
+		for k, v := range src.Data {
+			vals[k] = string(v)
+		}
+
+		err := clients.SetSecretValues(ctx, e.secrets, &xpv1.SecretReference{Name: ref.Name, Namespace: ns}, vals, opts)
+		if err != nil {
+			return false, errors.Wrap(err, errCopySecret)
+		}
+		e.log.Debug("Copied token secret", "secret", ref.Name, "namespace", ns)
+	}
+
+	for ns, cur := range have {
+		if want[ns] {
+			continue
+		}
+
+		inSync = false
+		if !apply {
+			continue
+		}
+
+		if err := e.secrets.Delete(ctx, cur); client.IgnoreNotFound(err) != nil {
+			return false, errors.Wrap(err, errDeleteSecretCopy)
+		}
+		e.log.Debug("Deleted token secret copy", "secret", ref.Name, "namespace", ns)
+	}
+
+	return inSync, nil
+}
+
+// deleteSecretCopies deletes all the copies of the token secret.
+func (e *external) deleteSecretCopies(ctx context.Context, cr tokenResource) error {
+	have, err := e.secretCopies(ctx, cr)
+	if err != nil {
+		return err
+	}
+
+	for ns, cur := range have {
+		if err := e.secrets.Delete(ctx, cur); client.IgnoreNotFound(err) != nil {
+			return errors.Wrap(err, errDeleteSecretCopy)
+		}
+		e.log.Debug("Deleted token secret copy", "secret", cur.GetName(), "namespace", ns)
+	}
+
+	return nil
+}
+
+// copyNamespaces returns the namespaces selected to hold a copy of the
+// token secret, besides its own namespace. Namespaces the provider config
+// does not allow are left out.
+func (e *external) copyNamespaces(ctx context.Context, cr tokenResource) (map[string]bool, error) {
+	ref := cr.GetTokenParameters().WriteTokenSecretToRef
+
+	res := map[string]bool{}
+	if ref.NamespaceSelector == nil {
+		return res, nil
+	}
+
+	sel, err := metav1.LabelSelectorAsSelector(ref.NamespaceSelector)
+	if err != nil {
+		return nil, errors.Wrap(err, errNamespaceSelector)
+	}
+
+	list := &corev1.NamespaceList{}
+	if err := e.secrets.List(ctx, list, client.MatchingLabelsSelector{Selector: sel}); err != nil {
+		return nil, errors.Wrap(err, errListNamespaces)
+	}
+
+	for i, ns := range list.Items {
+		if ns.GetName() == ref.Namespace || ns.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+
+		ok, err := clients.IsNamespaceAllowed(&list.Items[i], e.allowed)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			e.log.Debug("Namespace not allowed", "secret", ref.Name, "namespace", ns.GetName())
+			continue
+		}
+
+		res[ns.GetName()] = true
+	}
+
+	return res, nil
+}
+
+// secretCopies returns the existing copies of the token secret by namespace.
+func (e *external) secretCopies(ctx context.Context, cr tokenResource) (map[string]*corev1.Secret, error) {
+	ref := cr.GetTokenParameters().WriteTokenSecretToRef
+
+	// Namespaced tokens never write out of their own namespace, thus never
+	// look for copies anywhere else.
+	all, err := clients.ListOwnedSecrets(ctx, e.secrets, cr.GetNamespace(), ref.Name, secretOptions(cr))
+	if err != nil {
+		return nil, errors.Wrap(err, errListSecretCopies)
+	}
+
+	res := map[string]*corev1.Secret{}
+	for i := range all {
+		if ns := all[i].GetNamespace(); ns != ref.Namespace {
+			res[ns] = &all[i]
+		}
+	}
+
+	return res, nil
+}
+
+// tokensWithNamespaceSelector enqueues the Tokens copying their secret by
+// namespace selector whenever a namespace changes, so copies are written
+// as soon as namespaces appear and removed when they stop matching.
+func tokensWithNamespaceSelector(kube client.Client, log logging.Logger) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		list := &tokensv1alpha1.TokenList{}
+		if err := kube.List(context.Background(), list); err != nil {
+			log.Debug("Cannot list tokens", "error", err)
+			return nil
+		}
+
+		res := []reconcile.Request{}
+		for _, t := range list.Items {
+			if t.Spec.ForProvider.WriteTokenSecretToRef.NamespaceSelector == nil {
+				continue
+			}
+			res = append(res, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: t.GetName()},
+			})
+		}
+
+		return res
+	}
+}
@@ -0,0 +1,148 @@
+package token
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection"
+	"github.com/crossplane/crossplane-runtime/pkg/controller"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	"github.com/crossplane/crossplane-runtime/pkg/ratelimiter"
+	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	tokensv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/tokens/v1alpha1"
+	apisv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/v1alpha1"
+	"github.com/krateoplatformops/provider-argocd-token/pkg/features"
+)
+
+const (
+	errUpdateCriticalAnnotations    = "cannot update critical annotations"
+	errFmtConnectionSecretNamespace = "connection secret must be written to the %s namespace"
+	errFmtAccountNotAllowed         = "account %s is not allowed for NamespacedTokens by the %s provider config"
+	errDeletePCU                    = "cannot delete ProviderConfigUsage"
+)
+
+// SetupNamespaced adds a controller that reconciles NamespacedToken managed
+// resources.
+func SetupNamespaced(mgr ctrl.Manager, o controller.Options) error {
+	name := managed.ControllerName(tokensv1alpha1.NamespacedTokenGroupKind)
+
+	log := o.Logger.WithValues("controller", name)
+
+	recorder := mgr.GetEventRecorderFor(name)
+
+	cps := []managed.ConnectionPublisher{localConnectionPublisher(managed.NewAPISecretPublisher(mgr.GetClient(), mgr.GetScheme()))}
+	if o.Features.Enabled(features.EnableAlphaExternalSecretStores) {
+		cps = append(cps, connection.NewDetailsManager(mgr.GetClient(), apisv1alpha1.StoreConfigGroupVersionKind))
+	}
+
+	r := managed.NewReconciler(mgr,
+		resource.ManagedKind(tokensv1alpha1.NamespacedTokenGroupVersionKind),
+		managed.WithExternalConnecter(&connector{
+			kube: mgr.GetClient(),
+			log:  log,
+			rec:  recorder,
+		}),
+		managed.WithCriticalAnnotationUpdater(&criticalAnnotationUpdater{client: mgr.GetClient()}),
+		managed.WithFinalizer(&usageFinalizer{
+			Finalizer: resource.NewAPIFinalizer(mgr.GetClient(), managed.FinalizerName),
+			client:    mgr.GetClient(),
+		}),
+		managed.WithConnectionPublishers(cps...),
+		managed.WithLogger(log),
+		managed.WithRecorder(event.NewAPIRecorder(recorder)))
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		WithOptions(o.ForControllerRuntime()).
+		For(&tokensv1alpha1.NamespacedToken{}).
+		Complete(ratelimiter.NewReconciler(name, &scheduler{
+			Reconciler: r,
+			kube:       mgr.GetClient(),
+			newToken:   func() tokenResource { return &tokensv1alpha1.NamespacedToken{} },
+		}, o.GlobalRateLimiter))
+}
+
+// checkAccount returns an error if the token is a NamespacedToken whose
+// account is not listed by the provider config: tenants must not get tokens
+// for any account, i.e. admin.
+func (e *external) checkAccount(cr tokenResource) error {
+	if _, ok := cr.(*tokensv1alpha1.NamespacedToken); !ok {
+		return nil
+	}
+
+	account := cr.GetTokenParameters().Account
+	for _, a := range e.accounts {
+		if a == account {
+			return nil
+		}
+	}
+
+	return errors.Errorf(errFmtAccountNotAllowed, account, cr.GetProviderConfigReference().Name)
+}
+
+// A criticalAnnotationUpdater persists the critical annotations of namespaced
+// managed resources, retrying in the face of API server errors. The runtime
+// one only looks up cluster scoped resources.
+type criticalAnnotationUpdater struct {
+	client client.Client
+}
+
+func (u *criticalAnnotationUpdater) UpdateCriticalAnnotations(ctx context.Context, o client.Object) error {
+	a := o.GetAnnotations()
+	err := retry.OnError(retry.DefaultRetry, resource.IsAPIError, func() error {
+		nn := types.NamespacedName{Namespace: o.GetNamespace(), Name: o.GetName()}
+		if err := u.client.Get(ctx, nn, o); err != nil {
+			return err
+		}
+		meta.AddAnnotations(o, a)
+		return u.client.Update(ctx, o)
+	})
+	return errors.Wrap(err, errUpdateCriticalAnnotations)
+}
+
+// A usageFinalizer deletes the provider config usage of namespaced managed
+// resources along with their finalizer. Kubernetes never garbage collects it,
+// since a cluster scoped usage cannot be owned by a namespaced resource, and
+// the provider config could never be deleted otherwise.
+type usageFinalizer struct {
+	resource.Finalizer
+	client client.Client
+}
+
+func (f *usageFinalizer) RemoveFinalizer(ctx context.Context, obj resource.Object) error {
+	// Usages are named after the UID of the resource using the config.
+	pcu := &apisv1alpha1.ProviderConfigUsage{}
+	pcu.SetName(string(obj.GetUID()))
+	if err := f.client.Delete(ctx, pcu); resource.IgnoreNotFound(err) != nil {
+		return errors.Wrap(err, errDeletePCU)
+	}
+
+	return f.Finalizer.RemoveFinalizer(ctx, obj)
+}
+
+// localConnectionPublisher refuses to publish the connection details of
+// namespaced resources out of their own namespace.
+func localConnectionPublisher(cp managed.ConnectionPublisher) managed.ConnectionPublisher {
+	return managed.ConnectionPublisherFns{
+		PublishConnectionFn: func(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails) (bool, error) {
+			if ref := o.GetWriteConnectionSecretToReference(); ref != nil && ref.Namespace != o.GetNamespace() {
+				return false, errors.Errorf(errFmtConnectionSecretNamespace, o.GetNamespace())
+			}
+			return cp.PublishConnection(ctx, o, c)
+		},
+		UnpublishConnectionFn: func(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails) error {
+			if ref := o.GetWriteConnectionSecretToReference(); ref != nil && ref.Namespace != o.GetNamespace() {
+				return nil
+			}
+			return cp.UnpublishConnection(ctx, o, c)
+		},
+	}
+}
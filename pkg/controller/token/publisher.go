@@ -0,0 +1,88 @@
+package token
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	apisv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/v1alpha1"
+)
+
+const (
+	errGetStoreConfig = "cannot get StoreConfig"
+
+	errFmtStoreNotAllowed = "secret store %s is not allowed by the %s provider config: only the local Kubernetes store is"
+)
+
+// allowedConnectionPublisher refuses to publish the connection details of
+// tokens into namespaces their provider config does not allow, either by
+// writeConnectionSecretToRef or publishConnectionDetailsTo.
+func allowedConnectionPublisher(kube client.Client, cp managed.ConnectionPublisher) managed.ConnectionPublisher {
+	return managed.ConnectionPublisherFns{
+		PublishConnectionFn: func(ctx context.Context, o resource.ConnectionSecretOwner, c managed.ConnectionDetails) (bool, error) {
+			if err := checkConnectionNamespaces(ctx, kube, o); err != nil {
+				return false, err
+			}
+			return cp.PublishConnection(ctx, o, c)
+		},
+		UnpublishConnectionFn: cp.UnpublishConnection,
+	}
+}
+
+// checkConnectionNamespaces returns an error if the provider config of the
+// token does not allow any of the namespaces its connection details are
+// published to.
+func checkConnectionNamespaces(ctx context.Context, kube client.Client, o resource.ConnectionSecretOwner) error {
+	mg, ok := o.(resource.Managed)
+	if !ok || mg.GetProviderConfigReference() == nil {
+		return nil
+	}
+
+	pc := &apisv1alpha1.ProviderConfig{}
+	if err := kube.Get(ctx, types.NamespacedName{Name: mg.GetProviderConfigReference().Name}, pc); err != nil {
+		return errors.Wrap(err, errGetPC)
+	}
+
+	allowed := pc.Spec.AllowedSecretNamespaces
+	if allowed == nil {
+		return nil
+	}
+
+	namespaces := []string{}
+	if ref := o.GetWriteConnectionSecretToReference(); ref != nil {
+		namespaces = append(namespaces, ref.Namespace)
+	}
+
+	// Cluster scoped resources publish into the default scope of the store,
+	// which is a namespace of this cluster only for the local Kubernetes one.
+	if p := o.GetPublishConnectionDetailsTo(); p != nil {
+		sc := &apisv1alpha1.StoreConfig{}
+		if err := kube.Get(ctx, types.NamespacedName{Name: p.SecretStoreConfigRef.Name}, sc); err != nil {
+			return errors.Wrap(err, errGetStoreConfig)
+		}
+
+		cfg := sc.GetStoreConfig()
+		if (cfg.Type != nil && *cfg.Type != xpv1.SecretStoreKubernetes) || cfg.Kubernetes != nil {
+			return errors.Errorf(errFmtStoreNotAllowed, sc.GetName(), pc.GetName())
+		}
+		namespaces = append(namespaces, cfg.DefaultScope)
+	}
+
+	for _, ns := range namespaces {
+		ok, err := namespaceAllowed(ctx, kube, ns, allowed)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.Errorf(errFmtNamespaceNotAllowed, ns, pc.GetName())
+		}
+	}
+
+	return nil
+}
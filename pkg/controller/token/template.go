@@ -0,0 +1,84 @@
+package token
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	errParseSecretTemplate  = "cannot parse secret template for key %s"
+	errRenderSecretTemplate = "cannot render secret template for key %s"
+)
+
+// secretTemplateData is the data the secret templates are rendered with.
+type secretTemplateData struct {
+	// Token is the raw token.
+	Token string
+	// ID of the token.
+	ID string
+	// Account the token has been issued for.
+	Account string
+	// ServerURL of the Argo CD instance (i.e. https://argocd.example.com:443).
+	ServerURL string
+	// ServerAddr of the Argo CD instance, without scheme (i.e. argocd.example.com:443).
+	ServerAddr string
+	// ExpiresAt time the token will expire at, RFC 3339 formatted; empty if never.
+	ExpiresAt string
+}
+
+// secretTemplateFuncs is the restricted set of functions available to the
+// secret templates, on top of the text/template builtins.
+var secretTemplateFuncs = template.FuncMap{
+	"b64enc": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"quote": func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	},
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"default": func(def, s string) string {
+		if len(s) == 0 {
+			return def
+		}
+		return s
+	},
+}
+
+// renderSecretTemplate renders every template of the secret template,
+// returning the secret values keyed as the templates.
+func renderSecretTemplate(tpl map[string]string, data secretTemplateData) (map[string]string, error) {
+	res := make(map[string]string, len(tpl))
+	for key, text := range tpl {
+		t, err := template.New(key).Funcs(secretTemplateFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, errParseSecretTemplate, key)
+		}
+
+		buf := bytes.Buffer{}
+		if err := t.Execute(&buf, data); err != nil {
+			return nil, errors.Wrapf(err, errRenderSecretTemplate, key)
+		}
+		res[key] = buf.String()
+	}
+
+	return res, nil
+}
+
+// serverAddr returns the address of the server, without scheme.
+func serverAddr(serverURL string) string {
+	u, err := url.Parse(serverURL)
+	if err != nil || len(u.Host) == 0 {
+		return serverURL
+	}
+	return u.Host
+}
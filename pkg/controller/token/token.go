@@ -2,33 +2,69 @@ package token
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
 
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	"github.com/crossplane/crossplane-runtime/pkg/controller"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	"github.com/crossplane/crossplane-runtime/pkg/connection"
 	"github.com/crossplane/crossplane-runtime/pkg/event"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane-runtime/pkg/ratelimiter"
 	"github.com/crossplane/crossplane-runtime/pkg/reconciler/managed"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 
 	tokensv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/tokens/v1alpha1"
+	apisv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/v1alpha1"
 	"github.com/krateoplatformops/provider-argocd-token/pkg/clients"
 	"github.com/krateoplatformops/provider-argocd-token/pkg/clients/accounts"
+	"github.com/krateoplatformops/provider-argocd-token/pkg/features"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
-	errNotToken = "managed resource is not an argocd token custom resource"
-	//errGetPC          = "cannot get ProviderConfig"
+	errNotToken       = "managed resource is not an argocd token custom resource"
+	errUpdateStatus   = "cannot update token status"
+	errRevokeToken    = "cannot revoke token"
+	errGetAccount     = "cannot get account"
+	errParseSchedule  = "cannot parse rotation schedule"
+	errGetUserInfo    = "cannot validate token"
+	errConnectCluster = "cannot connect to the token secret cluster"
+	errGetPC          = "cannot get ProviderConfig"
+
+	errFmtNegativeDuration = "%s must not be negative"
+	errRenewBeforeTooLong  = "renewBefore must be shorter than expiresIn"
 	//errFmtKeyNotFound = "key %s is not found in referenced Kubernetes secret"
 )
 
+const (
+	// keyPreviousToken is the secret key holding the replaced token during
+	// the rotation grace period.
+	keyPreviousToken = "previousToken"
+
+	// keyAccount is the connection details key holding the account name.
+	keyAccount = "account"
+
+	// managedBy is the value of the managed-by label of the token secrets.
+	managedBy = "provider-argocd-token"
+)
+
 // Setup adds a controller that reconciles Token managed resources.
 func Setup(mgr ctrl.Manager, o controller.Options) error {
 	name := managed.ControllerName(tokensv1alpha1.TokenGroupKind)
@@ -37,6 +73,11 @@ func Setup(mgr ctrl.Manager, o controller.Options) error {
 
 	recorder := mgr.GetEventRecorderFor(name)
 
+	cps := []managed.ConnectionPublisher{managed.NewAPISecretPublisher(mgr.GetClient(), mgr.GetScheme())}
+	if o.Features.Enabled(features.EnableAlphaExternalSecretStores) {
+		cps = append(cps, connection.NewDetailsManager(mgr.GetClient(), apisv1alpha1.StoreConfigGroupVersionKind))
+	}
+
 	r := managed.NewReconciler(mgr,
 		resource.ManagedKind(tokensv1alpha1.TokenGroupVersionKind),
 		managed.WithExternalConnecter(&connector{
@@ -44,6 +85,7 @@ func Setup(mgr ctrl.Manager, o controller.Options) error {
 			log:  log,
 			rec:  recorder,
 		}),
+		managed.WithConnectionPublishers(allowedConnectionPublisher(mgr.GetClient(), managed.PublisherChain(cps))),
 		managed.WithLogger(log),
 		managed.WithRecorder(event.NewAPIRecorder(recorder)))
 
@@ -51,7 +93,57 @@ func Setup(mgr ctrl.Manager, o controller.Options) error {
 		Named(name).
 		WithOptions(o.ForControllerRuntime()).
 		For(&tokensv1alpha1.Token{}).
-		Complete(ratelimiter.NewReconciler(name, r, o.GlobalRateLimiter))
+		Watches(&source.Kind{Type: &corev1.Namespace{}},
+			handler.EnqueueRequestsFromMapFunc(tokensWithNamespaceSelector(mgr.GetClient(), log))).
+		Complete(ratelimiter.NewReconciler(name, &scheduler{
+			Reconciler: r,
+			kube:       mgr.GetClient(),
+			newToken:   func() tokenResource { return &tokensv1alpha1.Token{} },
+		}, o.GlobalRateLimiter))
+}
+
+// A tokenResource is a managed resource reconciled as an Argo CD token.
+type tokenResource interface {
+	resource.Managed
+	GetTokenParameters() tokensv1alpha1.TokenParameters
+	GetTokenObservation() *tokensv1alpha1.TokenObservation
+}
+
+// A scheduler requeues tokens in time for their next rotation or revocation,
+// which may come sooner than the poll interval.
+type scheduler struct {
+	reconcile.Reconciler
+	kube     client.Client
+	newToken func() tokenResource
+}
+
+func (s *scheduler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	res, err := s.Reconciler.Reconcile(ctx, req)
+	if err != nil || res.RequeueAfter == 0 {
+		return res, err
+	}
+
+	cr := s.newToken()
+	if err := s.kube.Get(ctx, req.NamespacedName, cr); err != nil {
+		return res, nil
+	}
+	obs := cr.GetTokenObservation()
+
+	deadlines := []*metav1.Time{obs.NextRotationTime}
+	for i := range obs.PendingRevocations {
+		deadlines = append(deadlines, &obs.PendingRevocations[i].RevokeAt)
+	}
+
+	for _, t := range deadlines {
+		if t == nil {
+			continue
+		}
+		if d := time.Until(t.Time); d > 0 && d < res.RequeueAfter {
+			res.RequeueAfter = d
+		}
+	}
+
+	return res, nil
 }
 
 type connector struct {
@@ -61,65 +153,186 @@ type connector struct {
 }
 
 func (c *connector) Connect(ctx context.Context, mg resource.Managed) (managed.ExternalClient, error) {
-	cr, ok := mg.(*tokensv1alpha1.Token)
+	cr, ok := mg.(tokenResource)
 	if !ok {
 		return nil, errors.New(errNotToken)
 	}
 
+	// Token secrets are written into the cluster the provider runs in,
+	// unless a remote cluster is referenced.
+	secrets := c.kube
+	if ref := cr.GetTokenParameters().WriteTokenSecretToRef.KubeconfigSecretRef; ref != nil {
+		cli, err := clients.NewClusterClient(ctx, c.kube, ref)
+		if err != nil {
+			cr.SetConditions(tokensv1alpha1.ClusterUnreachable(err.Error()))
+			return nil, errors.Wrap(err, errConnectCluster)
+		}
+		secrets = &reachabilityClient{Client: cli, cr: cr}
+	}
+
 	cfg, err := clients.GetConfig(ctx, c.kube, cr)
 	if err != nil {
 		return nil, err
 	}
 
-	c.log.Debug("Created session", "token", cfg.AuthToken)
+	pc := &apisv1alpha1.ProviderConfig{}
+	if err := c.kube.Get(ctx, types.NamespacedName{Name: cr.GetProviderConfigReference().Name}, pc); err != nil {
+		return nil, errors.Wrap(err, errGetPC)
+	}
+
+	c.log.Debug("Using session", "server", cfg.ServerUrl)
 
 	return &external{
-		kube: c.kube,
-		log:  c.log,
-		cfg:  cfg,
-		rec:  c.rec,
+		kube:     c.kube,
+		secrets:  secrets,
+		log:      c.log,
+		cfg:      cfg,
+		allowed:  pc.Spec.AllowedSecretNamespaces,
+		accounts: pc.Spec.NamespacedTokenAccounts,
+		rec:      c.rec,
 	}, nil
 }
 
 // An ExternalClient observes, then either creates, updates, or deletes an
 // external resource to ensure it reflects the managed resource's desired state.
 type external struct {
-	kube client.Client
-	log  logging.Logger
-	cfg  *accounts.TokenProviderOptions
-	rec  record.EventRecorder
+	kube     client.Client
+	secrets  client.Client
+	log      logging.Logger
+	cfg      *accounts.TokenProviderOptions
+	allowed  *apisv1alpha1.AllowedNamespaces
+	accounts []string
+	rec      record.EventRecorder
 }
 
 func (e *external) Observe(ctx context.Context, mg resource.Managed) (managed.ExternalObservation, error) {
-	cr, ok := mg.(*tokensv1alpha1.Token)
+	cr, ok := mg.(tokenResource)
 	if !ok {
 		return managed.ExternalObservation{}, errors.New(errNotToken)
 	}
 
-	spec := cr.Spec.ForProvider.DeepCopy()
+	spec := cr.GetTokenParameters()
 
-	token, err := clients.GetSecret(ctx, e.kube, &spec.WriteTokenSecretToRef)
-	if err != nil {
-		if clients.ErrorIsNotFound(err) {
-			// TODO handle token expiration?
-			return managed.ExternalObservation{
-				ResourceExists:   false,
-				ResourceUpToDate: true,
-			}, nil
-		}
+	// Secrets not owned yet are handed over according to the secret policy
+	// when the token is created.
+	token, err := clients.GetOwnedSecret(ctx, e.secrets, &spec.WriteTokenSecretToRef.SecretKeySelector, secretOptions(cr))
+	if err != nil && !clients.ErrorIsNotFound(err) {
 		return managed.ExternalObservation{}, err
 	}
 
-	if len(token) > 0 {
-		cr.SetConditions(xpv1.Available())
+	// Tokens created before their id was tracked can only be observed
+	// through the secret.
+	exists := len(token) > 0
+	if id := cr.GetTokenObservation().ID; len(id) > 0 {
+		// Tokens observed before their account was tracked have been
+		// issued for the specified one.
+		if len(cr.GetTokenObservation().Account) == 0 {
+			cr.GetTokenObservation().Account = spec.Account
+		}
+		account := cr.GetTokenObservation().Account
 
-		// TODO handle token expiration?
+		// Tokens of removed accounts are gone along with them.
+		acc, err := accounts.GetAccount(e.cfg, account)
+		if err != nil && !accounts.IsAccountNotFound(err) {
+			return managed.ExternalObservation{}, errors.Wrap(err, errGetAccount)
+		}
+
+		if acc == nil || acc.FindToken(id) == nil {
+			exists = false
+			if !meta.WasDeleted(cr) {
+				e.log.Debug("Token not found", "account", account, "id", id)
+				e.rec.Eventf(cr, corev1.EventTypeWarning, "TokenNotFound", "Token '%s' for account '%s' no longer exists", id, account)
+			}
+		}
+	}
+
+	// Keep deleting until the secret has gone too.
+	if meta.WasDeleted(cr) {
 		return managed.ExternalObservation{
-			ResourceExists:   true,
+			ResourceExists:   exists || len(token) > 0,
 			ResourceUpToDate: true,
 		}, nil
 	}
 
+	// Never mint nor write a token where the provider config does not allow.
+	if err := e.checkSecretNamespace(ctx, cr); err != nil {
+		return managed.ExternalObservation{}, err
+	}
+	if err := e.checkAccount(cr); err != nil {
+		return managed.ExternalObservation{}, err
+	}
+
+	if exists && len(token) > 0 {
+		cr.SetConditions(xpv1.Available())
+
+		rotate, err := rotationDue(cr, time.Now())
+		if err != nil {
+			return managed.ExternalObservation{}, err
+		}
+
+		drifted := secretDrifted(cr, token)
+		if drifted {
+			e.log.Debug("Token secret drifted", "account", spec.Account, "secret", spec.WriteTokenSecretToRef.Name)
+			e.rec.Eventf(cr, corev1.EventTypeWarning, "TokenSecretDrift", "Token for account '%s' in '%s' secret has been tampered, replacing it", spec.Account, spec.WriteTokenSecretToRef.Name)
+		}
+
+		// Make sure Argo CD still accepts the token (i.e. the signing key
+		// may have been rotated or the account disabled).
+		if !drifted {
+			info, err := accounts.GetUserInfo(e.cfg, token)
+			switch {
+			case accounts.IsUnauthenticated(err):
+				cr.SetConditions(tokensv1alpha1.TokenRejected(err.Error()))
+			case err != nil:
+				return managed.ExternalObservation{}, errors.Wrap(err, errGetUserInfo)
+			case !info.LoggedIn:
+				cr.SetConditions(tokensv1alpha1.TokenRejected("argocd does not authenticate the token"))
+			default:
+				cr.SetConditions(tokensv1alpha1.TokenAccepted())
+			}
+		}
+
+		rejected := tokenRejected(cr)
+		if rejected {
+			e.log.Debug("Token rejected", "account", spec.Account, "id", cr.GetTokenObservation().ID)
+			e.rec.Eventf(cr, corev1.EventTypeWarning, "TokenRejected", "Token '%s' for account '%s' is rejected by ArgoCD, replacing it", cr.GetTokenObservation().ID, spec.Account)
+		}
+
+		moved := accountChanged(cr)
+		if moved {
+			e.log.Debug("Token account changed", "account", cr.GetTokenObservation().Account, "want", spec.Account)
+		}
+
+		templated, copied := true, true
+		if !drifted {
+			templated, err = e.syncSecretTemplate(ctx, cr, token, false)
+			if err != nil {
+				return managed.ExternalObservation{}, err
+			}
+
+			copied, err = e.syncSecrets(ctx, cr, false)
+			if err != nil {
+				return managed.ExternalObservation{}, err
+			}
+		}
+
+		obs := managed.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: !rotate && !drifted && !rejected && !moved && templated && copied && !revocationDue(cr, time.Now()),
+		}
+		if !drifted {
+			obs.ConnectionDetails = e.connectionDetails(cr, token)
+		}
+
+		return obs, nil
+	}
+
+	// A token that has been written, then emptied or removed, has drifted too.
+	if obs := cr.GetTokenObservation(); len(token) == 0 && (len(obs.ID) > 0 || len(obs.Fingerprint) > 0) {
+		e.log.Debug("Token secret drifted", "account", spec.Account, "secret", spec.WriteTokenSecretToRef.Name)
+		e.rec.Eventf(cr, corev1.EventTypeWarning, "TokenSecretDrift", "Token for account '%s' in '%s' secret has been removed, replacing it", spec.Account, spec.WriteTokenSecretToRef.Name)
+	}
+
 	return managed.ExternalObservation{
 		ResourceExists:   false,
 		ResourceUpToDate: true,
@@ -127,51 +340,660 @@ func (e *external) Observe(ctx context.Context, mg resource.Managed) (managed.Ex
 }
 
 func (e *external) Create(ctx context.Context, mg resource.Managed) (managed.ExternalCreation, error) {
-	cr, ok := mg.(*tokensv1alpha1.Token)
+	cr, ok := mg.(tokenResource)
 	if !ok {
 		return managed.ExternalCreation{}, errors.New(errNotToken)
 	}
 
+	spec := cr.GetTokenParameters()
+
+	// Nothing is revoked unless the new token can be saved. Checked while
+	// still ready, to claim the secrets written before they were labeled.
+	if err := e.checkIssuable(ctx, cr); err != nil {
+		return managed.ExternalCreation{}, err
+	}
+
 	cr.SetConditions(xpv1.Creating())
 
-	spec := cr.Spec.ForProvider.DeepCopy()
+	// An explicit token id cannot be shared by two tokens at the same time,
+	// so the token we are replacing, if any, has to be revoked first.
+	old, oldAccount := cr.GetTokenObservation().ID, tokenAccount(cr)
+	if len(old) > 0 && old == spec.ID {
+		if err := accounts.DeleteToken(e.cfg, oldAccount, old); err != nil {
+			return managed.ExternalCreation{}, errors.Wrap(err, errRevokeToken)
+		}
+	}
 
-	token, err := accounts.GenerateToken(e.cfg, spec.Account, 0)
+	token, err := e.issueToken(ctx, cr)
 	if err != nil {
 		return managed.ExternalCreation{}, err
 	}
-	e.log.Debug("Generated token", "account", spec.Account)
-	e.rec.Eventf(cr, corev1.EventTypeNormal, "TokenCreated", "Generated token for account: %s", spec.Account)
 
-	if err := clients.SetSecret(ctx, e.kube, &spec.WriteTokenSecretToRef, token); err != nil {
+	// Otherwise it is revoked by the next update, once replaced.
+	if len(old) > 0 && old != spec.ID {
+		cr.GetTokenObservation().PendingRevocations = append(cr.GetTokenObservation().PendingRevocations, tokensv1alpha1.TokenRevocation{
+			ID:       old,
+			Account:  oldAccount,
+			RevokeAt: metav1.Now(),
+		})
+	}
+
+	// The managed reconciler discards any status change made during Create,
+	// so we persist the observation explicitly.
+	if err := e.kube.Status().Update(ctx, cr); err != nil {
+		// The new token would never be revoked without its observation.
+		e.revokeUntracked(cr, spec.Account, cr.GetTokenObservation().ID)
+		return managed.ExternalCreation{}, errors.Wrap(err, errUpdateStatus)
+	}
+
+	if _, err := e.syncSecrets(ctx, cr, true); err != nil {
 		return managed.ExternalCreation{}, err
 	}
-	e.log.Debug("Saved token as secret", "account", spec.Account, "secret", spec.WriteTokenSecretToRef.Name)
-	e.rec.Eventf(cr, corev1.EventTypeNormal, "TokenSaved", "Saved token for account '%s' into '%s' secret", spec.Account, spec.WriteTokenSecretToRef.Name)
 
-	return managed.ExternalCreation{}, nil
+	return managed.ExternalCreation{
+		ConnectionDetails: e.connectionDetails(cr, token),
+	}, nil
 }
 
 func (e *external) Update(ctx context.Context, mg resource.Managed) (managed.ExternalUpdate, error) {
-	return managed.ExternalUpdate{}, nil // noop
+	cr, ok := mg.(tokenResource)
+	if !ok {
+		return managed.ExternalUpdate{}, errors.New(errNotToken)
+	}
+
+	spec := cr.GetTokenParameters()
+
+	rotate, err := rotationDue(cr, time.Now())
+	if err != nil {
+		return managed.ExternalUpdate{}, err
+	}
+
+	token, err := clients.GetOwnedSecret(ctx, e.secrets, &spec.WriteTokenSecretToRef.SecretKeySelector, secretOptions(cr))
+	if err != nil {
+		return managed.ExternalUpdate{}, err
+	}
+
+	// Neither a tampered nor a rejected token, nor one for another account,
+	// is worth keeping as the previous token.
+	drifted := secretDrifted(cr, token)
+	rejected := tokenRejected(cr)
+	moved := accountChanged(cr)
+	upd := managed.ExternalUpdate{}
+	if rotate || drifted || rejected || moved {
+		token, err := e.rotateToken(ctx, cr, !drifted && !rejected && !moved)
+		if err != nil {
+			return managed.ExternalUpdate{}, err
+		}
+		upd.ConnectionDetails = e.connectionDetails(cr, token)
+	} else if _, err := e.syncSecretTemplate(ctx, cr, token, true); err != nil {
+		// The secret template of new tokens is rendered along with them.
+		return managed.ExternalUpdate{}, err
+	}
+
+	if err := e.revokeReplacedTokens(ctx, cr, time.Now()); err != nil {
+		return managed.ExternalUpdate{}, err
+	}
+
+	if _, err := e.syncSecrets(ctx, cr, true); err != nil {
+		return managed.ExternalUpdate{}, err
+	}
+
+	return upd, nil
 }
 
 func (e *external) Delete(ctx context.Context, mg resource.Managed) error {
-	cr, ok := mg.(*tokensv1alpha1.Token)
+	cr, ok := mg.(tokenResource)
 	if !ok {
 		return errors.New(errNotToken)
 	}
 
+	// Options are taken while still ready, to claim the secrets written
+	// before they were labeled.
+	opts := secretOptions(cr)
+
 	cr.SetConditions(xpv1.Deleting())
 
-	spec := cr.Spec.ForProvider.DeepCopy()
+	spec := cr.GetTokenParameters()
+
+	if cr.GetDeletionPolicy() != xpv1.DeletionOrphan {
+		all := []tokensv1alpha1.TokenRevocation{{ID: cr.GetTokenObservation().ID, Account: tokenAccount(cr)}}
+		all = append(all, cr.GetTokenObservation().PendingRevocations...)
+
+		for _, r := range all {
+			if len(r.ID) == 0 {
+				continue
+			}
+			account := revocationAccount(cr, r)
+			e.log.Debug("Revoking token", "account", account, "id", r.ID)
+
+			if err := accounts.DeleteToken(e.cfg, account, r.ID); err != nil {
+				return errors.Wrap(err, errRevokeToken)
+			}
+			e.rec.Eventf(cr, corev1.EventTypeNormal, "TokenRevoked", "Revoked token '%s' for account: %s", r.ID, account)
+		}
+	}
 
 	e.log.Debug("Deleting token secret", "account", spec.Account, "secret", spec.WriteTokenSecretToRef.Name)
 
-	err := clients.DeleteSecret(ctx, e.kube, &spec.WriteTokenSecretToRef)
+	if err := e.deleteSecretCopies(ctx, cr); err != nil {
+		return err
+	}
+
+	err := clients.DeleteOwnedSecret(ctx, e.secrets, &spec.WriteTokenSecretToRef.SecretReference, opts)
+	if err != nil && !clients.ErrorIsNotFound(err) {
+		return err
+	}
+	e.rec.Eventf(cr, corev1.EventTypeNormal, "TokenDeleted", "Deleted token for account '%s' into '%s' secret", spec.Account, spec.WriteTokenSecretToRef.Name)
+
+	return nil
+}
+
+// checkIssuable returns an error if a new token could be neither scheduled
+// nor saved: i.e. its secret template is broken or its secret is not owned.
+// The secret is claimed if it exists.
+func (e *external) checkIssuable(ctx context.Context, cr tokenResource) error {
+	spec := cr.GetTokenParameters()
+
+	// Validated by the webhook as well, which may not be enabled.
+	if err := checkDurations(&spec); err != nil {
+		return err
+	}
+
+	if _, err := nextRotationTime(cr); err != nil {
+		return err
+	}
+
+	if _, err := renderSecretTemplate(spec.SecretTemplate, secretTemplateData{}); err != nil {
+		return err
+	}
+
+	return clients.SetSecretValues(ctx, e.secrets, &spec.WriteTokenSecretToRef.SecretReference, nil, secretOptions(cr))
+}
+
+// issueToken generates a new token for the account, saves it into the
+// secret and records its observation. It returns the new token.
+func (e *external) issueToken(ctx context.Context, cr tokenResource) (string, error) {
+	spec := cr.GetTokenParameters()
+
+	id := spec.ID
+	if len(id) == 0 {
+		id = uuid.New().String()
+	}
+
+	var expiresIn int64
+	if spec.ExpiresIn != nil {
+		expiresIn = int64(spec.ExpiresIn.Duration.Seconds())
+	}
+
+	token, err := accounts.GenerateToken(e.cfg, spec.Account, id, expiresIn)
+	if err != nil {
+		return "", err
+	}
+	e.log.Debug("Generated token", "account", spec.Account, "id", id)
+	e.rec.Eventf(cr, corev1.EventTypeNormal, "TokenCreated", "Generated token '%s' for account: %s", id, spec.Account)
+
+	obs, err := generateTokenObservation(&spec, id, token)
+	if err != nil {
+		e.log.Debug("Cannot decode token claims", "account", spec.Account, "error", err)
+	}
+
+	vals, err := secretTemplateValues(&spec, &obs, e.cfg.ServerUrl, token)
 	if err == nil {
-		e.rec.Eventf(cr, corev1.EventTypeNormal, "TokenDeleted", "Deleted token for account '%s' into '%s' secret", spec.Account, spec.WriteTokenSecretToRef.Name)
+		for _, k := range cr.GetTokenObservation().SecretTemplateKeys {
+			if _, ok := vals[k]; !ok {
+				vals[k] = ""
+			}
+		}
+		vals[spec.WriteTokenSecretToRef.Key] = token
+		err = clients.SetSecretValues(ctx, e.secrets, &spec.WriteTokenSecretToRef.SecretReference, vals, secretOptions(cr))
+	}
+	if err != nil {
+		e.revokeUntracked(cr, spec.Account, obs.ID)
+		return "", err
+	}
+	e.log.Debug("Saved token as secret", "account", spec.Account, "secret", spec.WriteTokenSecretToRef.Name)
+	e.rec.Eventf(cr, corev1.EventTypeNormal, "TokenSaved", "Saved token for account '%s' into '%s' secret", spec.Account, spec.WriteTokenSecretToRef.Name)
+	obs.Account = spec.Account
+	obs.Fingerprint = fingerprint(token)
+	cr.SetConditions(tokensv1alpha1.TokenAccepted())
+	obs.PendingRevocations = cr.GetTokenObservation().PendingRevocations
+	obs.SecretTemplateKeys = secretTemplateKeys(&spec)
+	*cr.GetTokenObservation() = obs
+	cr.GetTokenObservation().LastRotationTime = &metav1.Time{Time: time.Now()}
+	cr.GetTokenObservation().LastRotationRequest = cr.GetAnnotations()[tokensv1alpha1.AnnotationKeyRotateRequestedAt]
+
+	next, err := nextRotationTime(cr)
+	if err != nil {
+		return "", err
+	}
+	if next != nil {
+		cr.GetTokenObservation().NextRotationTime = &metav1.Time{Time: *next}
+	}
+
+	return token, nil
+}
+
+// revokeUntracked revokes a token that could not be saved or tracked, since
+// a token nobody knows of must not stay valid. Failures are only reported.
+func (e *external) revokeUntracked(cr tokenResource, account, id string) {
+	if err := accounts.DeleteToken(e.cfg, account, id); err != nil {
+		e.log.Info("Cannot revoke untracked token", "account", account, "id", id, "error", err)
+		e.rec.Eventf(cr, corev1.EventTypeWarning, "TokenLeaked", "Cannot revoke untracked token '%s' for account '%s': %s", id, account, err)
+		return
+	}
+	e.log.Debug("Revoked untracked token", "account", account, "id", id)
+}
+
+// syncSecretTemplate keeps the keys rendered from the secret template up to
+// date with the token, removing the keys no longer templated, without
+// minting a new token. Nothing is changed unless apply is set. It returns
+// true if the keys were already up to date.
+func (e *external) syncSecretTemplate(ctx context.Context, cr tokenResource, token string, apply bool) (bool, error) {
+	spec := cr.GetTokenParameters()
+	ref := spec.WriteTokenSecretToRef
+
+	vals, err := secretTemplateValues(&spec, cr.GetTokenObservation(), e.cfg.ServerUrl, token)
+	if err != nil {
+		return false, err
+	}
+	for _, k := range cr.GetTokenObservation().SecretTemplateKeys {
+		if _, ok := vals[k]; !ok {
+			vals[k] = ""
+		}
+	}
+
+	s := &corev1.Secret{}
+	if err := e.secrets.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, s); err != nil {
+		return false, err
+	}
+
+	inSync := true
+	for k, v := range vals {
+		if cur, ok := s.Data[k]; ok != (len(v) > 0) || string(cur) != v {
+			inSync = false
+		}
+	}
+
+	if !inSync {
+		if !apply {
+			return false, nil
+		}
+
+		if err := clients.SetSecretValues(ctx, e.secrets, &ref.SecretReference, vals, secretOptions(cr)); err != nil {
+			return false, err
+		}
+		e.log.Debug("Rendered token secret template", "account", spec.Account, "secret", ref.Name)
+	}
+	cr.GetTokenObservation().SecretTemplateKeys = secretTemplateKeys(&spec)
+
+	return inSync, nil
+}
+
+// rotateToken replaces the current token with a new one, which is returned.
+// The replaced token is scheduled for revocation right away, or at the end
+// of the rotation grace period if any and graceful; revokeReplacedTokens
+// takes care of it.
+func (e *external) rotateToken(ctx context.Context, cr tokenResource, graceful bool) (string, error) {
+	spec := cr.GetTokenParameters()
+
+	old, oldAccount := cr.GetTokenObservation().ID, tokenAccount(cr)
+
+	// An explicit token id cannot be shared by two tokens at the same time,
+	// so the old token must be revoked before minting the new one.
+	grace := graceful && spec.RotationGracePeriod != nil && len(old) > 0 && old != spec.ID
+
+	// Nothing is revoked unless the new token can be saved.
+	if err := e.checkIssuable(ctx, cr); err != nil {
+		return "", err
+	}
+
+	var prev string
+	if grace {
+		var err error
+		prev, err = clients.GetSecret(ctx, e.secrets, &spec.WriteTokenSecretToRef.SecretKeySelector)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if len(old) > 0 && old == spec.ID {
+		if err := accounts.DeleteToken(e.cfg, oldAccount, old); err != nil {
+			return "", errors.Wrap(err, errRevokeToken)
+		}
+	}
+
+	token, err := e.issueToken(ctx, cr)
+	if err != nil {
+		return "", err
+	}
+
+	// The replaced token is recorded before anything else can fail, since
+	// the new one has already taken its place in the observation.
+	if len(old) > 0 && old != spec.ID {
+		revokeAt := metav1.Now()
+		if grace {
+			revokeAt = metav1.NewTime(revokeAt.Add(spec.RotationGracePeriod.Duration))
+		}
+
+		cr.GetTokenObservation().PendingRevocations = append(cr.GetTokenObservation().PendingRevocations, tokensv1alpha1.TokenRevocation{
+			ID:       old,
+			Account:  oldAccount,
+			RevokeAt: revokeAt,
+		})
+	}
+
+	if grace {
+		err := clients.SetSecretValues(ctx, e.secrets, &spec.WriteTokenSecretToRef.SecretReference, map[string]string{
+			keyPreviousToken: prev,
+		}, secretOptions(cr))
+		if err != nil {
+			return "", err
+		}
+	}
+	e.log.Debug("Renewed token", "account", spec.Account, "old", old, "id", cr.GetTokenObservation().ID)
+	e.rec.Eventf(cr, corev1.EventTypeNormal, "TokenRenewed", "Renewed token '%s' for account '%s' with '%s'", old, spec.Account, cr.GetTokenObservation().ID)
+
+	return token, nil
+}
+
+// revokeReplacedTokens revokes the replaced tokens whose grace period is over.
+// The previous token is removed from the secret once they are all revoked.
+func (e *external) revokeReplacedTokens(ctx context.Context, cr tokenResource, now time.Time) error {
+	spec := cr.GetTokenParameters()
+
+	all := cr.GetTokenObservation().PendingRevocations
+	if len(all) == 0 {
+		return nil
+	}
+
+	pending := []tokensv1alpha1.TokenRevocation{}
+	for i, r := range all {
+		if now.Before(r.RevokeAt.Time) {
+			pending = append(pending, r)
+			continue
+		}
+
+		account := revocationAccount(cr, r)
+		if err := accounts.DeleteToken(e.cfg, account, r.ID); err != nil {
+			// Keep track of what has not been revoked yet.
+			cr.GetTokenObservation().PendingRevocations = append(pending, all[i:]...)
+			return errors.Wrap(err, errRevokeToken)
+		}
+		e.log.Debug("Revoked replaced token", "account", account, "id", r.ID)
+		e.rec.Eventf(cr, corev1.EventTypeNormal, "TokenRevoked", "Revoked token '%s' for account: %s", r.ID, account)
+	}
+
+	if len(pending) > 0 {
+		cr.GetTokenObservation().PendingRevocations = pending
+		return nil
+	}
+	cr.GetTokenObservation().PendingRevocations = nil
+
+	return clients.SetSecretValues(ctx, e.secrets, &spec.WriteTokenSecretToRef.SecretReference, map[string]string{
+		keyPreviousToken: "",
+	}, secretOptions(cr))
+}
+
+// secretTemplateValues returns the secret values rendered from the secret
+// template for the token, leaving out the keys holding tokens.
+func secretTemplateValues(spec *tokensv1alpha1.TokenParameters, obs *tokensv1alpha1.TokenObservation, serverURL, token string) (map[string]string, error) {
+	data := secretTemplateData{
+		Token:      token,
+		ID:         obs.ID,
+		Account:    spec.Account,
+		ServerURL:  serverURL,
+		ServerAddr: serverAddr(serverURL),
+	}
+	if obs.ExpiresAt != nil {
+		data.ExpiresAt = obs.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	vals, err := renderSecretTemplate(spec.SecretTemplate, data)
+	if err != nil {
+		return nil, err
+	}
+	delete(vals, spec.WriteTokenSecretToRef.Key)
+	delete(vals, keyPreviousToken)
+
+	return vals, nil
+}
+
+// secretTemplateKeys returns the sorted keys rendered from the secret template.
+func secretTemplateKeys(spec *tokensv1alpha1.TokenParameters) []string {
+	res := []string{}
+	for k := range spec.SecretTemplate {
+		if k != spec.WriteTokenSecretToRef.Key && k != keyPreviousToken {
+			res = append(res, k)
+		}
+	}
+	sort.Strings(res)
+
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// rotationDue returns true if the token has to be rotated.
+func rotationDue(cr tokenResource, now time.Time) (bool, error) {
+	next, err := nextRotationTime(cr)
+	if err != nil {
+		return false, err
+	}
+
+	cr.GetTokenObservation().NextRotationTime = nil
+	if next != nil {
+		cr.GetTokenObservation().NextRotationTime = &metav1.Time{Time: *next}
+	}
+
+	return (next != nil && !now.Before(*next)) || rotationRequested(cr), nil
+}
+
+// revocationDue returns true if any replaced token has to be revoked.
+func revocationDue(cr tokenResource, now time.Time) bool {
+	for _, r := range cr.GetTokenObservation().PendingRevocations {
+		if !now.Before(r.RevokeAt.Time) {
+			return true
+		}
+	}
+	return false
+}
+
+// connectionDetails returns the details to connect to Argo CD with the token.
+func (e *external) connectionDetails(cr tokenResource, token string) managed.ConnectionDetails {
+	return managed.ConnectionDetails{
+		xpv1.ResourceCredentialsSecretTokenKey:    []byte(token),
+		xpv1.ResourceCredentialsSecretEndpointKey: []byte(e.cfg.ServerUrl),
+		keyAccount: []byte(cr.GetTokenParameters().Account),
+	}
+}
+
+// secretDrifted returns true if the token in the secret is not the one that
+// has been written.
+func secretDrifted(cr tokenResource, token string) bool {
+	fp := cr.GetTokenObservation().Fingerprint
+	return len(fp) > 0 && fp != fingerprint(token)
+}
+
+// tokenAccount returns the account the current token has been issued for,
+// which is the specified one unless it has changed since.
+func tokenAccount(cr tokenResource) string {
+	if account := cr.GetTokenObservation().Account; len(account) > 0 {
+		return account
+	}
+	return cr.GetTokenParameters().Account
+}
+
+// revocationAccount returns the account the replaced token has been issued
+// for; the specified one if not recorded.
+func revocationAccount(cr tokenResource, r tokensv1alpha1.TokenRevocation) string {
+	if len(r.Account) > 0 {
+		return r.Account
+	}
+	return cr.GetTokenParameters().Account
+}
+
+// accountChanged returns true if the current token has been issued for
+// another account than the specified one.
+func accountChanged(cr tokenResource) bool {
+	return len(cr.GetTokenObservation().ID) > 0 && tokenAccount(cr) != cr.GetTokenParameters().Account
+}
+
+// tokenRejected returns true if Argo CD has been observed rejecting the token.
+func tokenRejected(cr tokenResource) bool {
+	return cr.GetCondition(tokensv1alpha1.TypeTokenValid).Status == corev1.ConditionFalse
+}
+
+// fingerprint returns the SHA-256 fingerprint of the token.
+func fingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// secretOptions returns the options to write the token secrets with.
+func secretOptions(cr tokenResource) clients.SecretOptions {
+	spec := cr.GetTokenParameters()
+	policy := spec.SecretPolicy
+	ref := spec.WriteTokenSecretToRef
+
+	// Tokens that have already written their secret, as told by their
+	// observation or readiness, keep owning it even if written before the
+	// owner labels were introduced.
+	obs := cr.GetTokenObservation()
+	written := len(obs.ID) > 0 || len(obs.Fingerprint) > 0 ||
+		cr.GetCondition(xpv1.TypeReady).Status == corev1.ConditionTrue
+
+	opts := clients.SecretOptions{
+		OwnerLabels:    ownerLabels(cr),
+		Adopt:          policy == tokensv1alpha1.SecretPolicyAdopt,
+		Overwrite:      policy == tokensv1alpha1.SecretPolicyOverwrite,
+		ClaimUnlabeled: written,
+		Immutable:      ref.Immutable,
+	}
+
+	if md := ref.Metadata; md != nil {
+		opts.Labels = md.Labels
+		opts.Annotations = md.Annotations
+		if md.Type != nil {
+			opts.Type = *md.Type
+		}
+	}
+
+	return opts
+}
+
+// ownerLabels returns the labels marking the secrets owned by the token.
+// Each kind of token has its own label, so that a Token and a NamespacedToken
+// sharing the same name never claim each other's secrets; NamespacedTokens
+// are told apart by namespace too.
+func ownerLabels(cr tokenResource) map[string]string {
+	if _, ok := cr.(*tokensv1alpha1.NamespacedToken); ok {
+		return map[string]string{
+			tokensv1alpha1.LabelKeyManagedBy:                managedBy,
+			tokensv1alpha1.LabelKeyNamespacedToken:          cr.GetName(),
+			tokensv1alpha1.LabelKeyNamespacedTokenNamespace: cr.GetNamespace(),
+		}
+	}
+
+	return map[string]string{
+		tokensv1alpha1.LabelKeyManagedBy: managedBy,
+		tokensv1alpha1.LabelKeyToken:     cr.GetName(),
+	}
+}
+
+// checkDurations returns an error if any duration is negative, or if tokens
+// would be due for renewal as soon as they are minted.
+func checkDurations(spec *tokensv1alpha1.TokenParameters) error {
+	for _, d := range []struct {
+		name string
+		val  *metav1.Duration
+	}{
+		{"expiresIn", spec.ExpiresIn},
+		{"renewBefore", spec.RenewBefore},
+		{"rotationGracePeriod", spec.RotationGracePeriod},
+	} {
+		if d.val != nil && d.val.Duration < 0 {
+			return errors.Errorf(errFmtNegativeDuration, d.name)
+		}
+	}
+
+	if spec.ExpiresIn != nil && spec.RenewBefore != nil && spec.RenewBefore.Duration >= spec.ExpiresIn.Duration {
+		return errors.New(errRenewBeforeTooLong)
+	}
+
+	return nil
+}
+
+// nextRotationTime returns the time the token has to be rotated at, either
+// because it is going to expire or because it is scheduled; nil if never.
+func nextRotationTime(cr tokenResource) (*time.Time, error) {
+	spec := cr.GetTokenParameters()
+	obs := cr.GetTokenObservation().DeepCopy()
+
+	var next *time.Time
+	if obs.ExpiresAt != nil {
+		renewAt := obs.ExpiresAt.Time
+		if spec.RenewBefore != nil {
+			renewAt = renewAt.Add(-spec.RenewBefore.Duration)
+		}
+		next = &renewAt
+	}
+
+	if len(spec.RotationSchedule) > 0 {
+		sched, err := cron.ParseStandard(spec.RotationSchedule)
+		if err != nil {
+			return nil, errors.Wrap(err, errParseSchedule)
+		}
+
+		last := cr.GetCreationTimestamp().Time
+		if obs.LastRotationTime != nil {
+			last = obs.LastRotationTime.Time
+		} else if obs.IssuedAt != nil {
+			last = obs.IssuedAt.Time
+		}
+
+		if rotateAt := sched.Next(last); next == nil || rotateAt.Before(*next) {
+			next = &rotateAt
+		}
+	}
+
+	return next, nil
+}
+
+// rotationRequested returns true if an on-demand rotation has been requested
+// and not yet handled.
+func rotationRequested(cr tokenResource) bool {
+	req := cr.GetAnnotations()[tokensv1alpha1.AnnotationKeyRotateRequestedAt]
+	return len(req) > 0 && req != cr.GetTokenObservation().LastRotationRequest
+}
+
+// generateTokenObservation returns the observation of the specified
+// token, enriched with the claims decoded from the token itself.
+func generateTokenObservation(spec *tokensv1alpha1.TokenParameters, id, token string) (tokensv1alpha1.TokenObservation, error) {
+	obs := tokensv1alpha1.TokenObservation{ID: id}
+	if spec.ExpiresIn != nil {
+		obs.ExpiresIn = spec.ExpiresIn.Duration.String()
+	}
+
+	claims, err := accounts.ParseClaims(token)
+	if err != nil {
+		return obs, err
+	}
+
+	if len(claims.ID) > 0 {
+		obs.ID = claims.ID
+	}
+	obs.Subject = claims.Subject
+
+	if claims.IssuedAt > 0 {
+		t := metav1.Unix(claims.IssuedAt, 0)
+		obs.IssuedAt = &t
+	}
+
+	if claims.ExpiresAt > 0 {
+		t := metav1.Unix(claims.ExpiresAt, 0)
+		obs.ExpiresAt = &t
 	}
 
-	return err
+	return obs, nil
 }
@@ -0,0 +1,402 @@
+package token
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	tokensv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/tokens/v1alpha1"
+	"github.com/krateoplatformops/provider-argocd-token/pkg/clients/accounts"
+)
+
+var errBoom = errors.New("boom")
+
+// argocdServer mints and revokes the tokens of any account, keeping track of
+// the valid ones as "account/id".
+type argocdServer struct {
+	mu         sync.Mutex
+	valid      map[string]bool
+	failRevoke map[string]bool
+}
+
+func newArgocdServer(valid ...string) *argocdServer {
+	s := &argocdServer{valid: map[string]bool{}, failRevoke: map[string]bool{}}
+	for _, t := range valid {
+		s.valid[t] = true
+	}
+	return s
+}
+
+func (s *argocdServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/account/"), "/")
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "token":
+		body := struct {
+			ID string `json:"id"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.valid[parts[0]+"/"+body.ID] = true
+		json.NewEncoder(w).Encode(map[string]string{"token": tokenFor(parts[0], body.ID)})
+	case r.Method == http.MethodDelete && len(parts) == 3 && parts[1] == "token":
+		key := parts[0] + "/" + parts[2]
+		if s.failRevoke[key] {
+			http.Error(w, "cannot revoke", http.StatusInternalServerError)
+			return
+		}
+		if !s.valid[key] {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.valid, key)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// tokens returns the valid tokens, sorted.
+func (s *argocdServer) tokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := []string{}
+	for t := range s.valid {
+		res = append(res, t)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// tokenFor returns the unsigned token of the account with the specified id,
+// always the same.
+func tokenFor(account, id string) string {
+	claims, _ := json.Marshal(map[string]interface{}{
+		"jti": id,
+		"sub": account + ":apiKey",
+	})
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString(claims) + ".sig"
+}
+
+// A failingClient fails the writes of the secrets matching failWrite.
+type failingClient struct {
+	client.Client
+	failWrite func(s *corev1.Secret) bool
+}
+
+func (c *failingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if s, ok := obj.(*corev1.Secret); ok && c.failWrite != nil && c.failWrite(s) {
+		return errBoom
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *failingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if s, ok := obj.(*corev1.Secret); ok && c.failWrite != nil && c.failWrite(s) {
+		return errBoom
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+// newToken returns a Token of the account whose rotation has been requested,
+// holding the specified token.
+func newToken(account, id string) *tokensv1alpha1.Token {
+	return &tokensv1alpha1.Token{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ci",
+			Annotations: map[string]string{tokensv1alpha1.AnnotationKeyRotateRequestedAt: "now"},
+		},
+		Spec: tokensv1alpha1.TokenSpec{
+			ForProvider: tokensv1alpha1.TokenParameters{
+				CommonTokenParameters: tokensv1alpha1.CommonTokenParameters{Account: account},
+				WriteTokenSecretToRef: tokensv1alpha1.TokenSecretReference{
+					SecretKeySelector: xpv1.SecretKeySelector{
+						SecretReference: xpv1.SecretReference{Name: "ci-token", Namespace: "default"},
+						Key:             "token",
+					},
+				},
+			},
+		},
+		Status: tokensv1alpha1.TokenStatus{
+			AtProvider: tokensv1alpha1.TokenObservation{
+				ID:          id,
+				Account:     account,
+				Fingerprint: fingerprint(tokenFor(account, id)),
+			},
+		},
+	}
+}
+
+// newTokenSecret returns the secret owned by the Token holding its token.
+func newTokenSecret(cr *tokensv1alpha1.Token) *corev1.Secret {
+	obs := cr.Status.AtProvider
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ci-token", Namespace: "default", Labels: ownerLabels(cr)},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{"token": []byte(tokenFor(obs.Account, obs.ID))},
+	}
+}
+
+func newExternal(srv *httptest.Server, secrets client.Client) *external {
+	return &external{
+		kube:    secrets,
+		secrets: secrets,
+		log:     logging.NewNopLogger(),
+		cfg:     &accounts.TokenProviderOptions{ServerUrl: srv.URL, AuthToken: "session"},
+		rec:     record.NewFakeRecorder(100),
+	}
+}
+
+func TestUpdateRotation(t *testing.T) {
+	cases := map[string]struct {
+		cr         *tokensv1alpha1.Token
+		grace      *metav1.Duration
+		failRevoke []string
+		failWrite  func(s *corev1.Secret) bool
+
+		wantErr      bool
+		wantNew      bool
+		wantValid    []string
+		wantPending  []string
+		wantPrevious bool
+	}{
+		"RevokeReplacedToken": {
+			cr:        newToken("alice", "old"),
+			wantNew:   true,
+			wantValid: []string{"alice/new"},
+		},
+		"KeepReplacedTokenWhenRevokeFails": {
+			cr:          newToken("alice", "old"),
+			failRevoke:  []string{"alice/old"},
+			wantErr:     true,
+			wantNew:     true,
+			wantValid:   []string{"alice/new", "alice/old"},
+			wantPending: []string{"alice/old"},
+		},
+		"KeepReplacedTokenForGracePeriod": {
+			cr:           newToken("alice", "old"),
+			grace:        &metav1.Duration{Duration: time.Hour},
+			wantNew:      true,
+			wantValid:    []string{"alice/new", "alice/old"},
+			wantPending:  []string{"alice/old"},
+			wantPrevious: true,
+		},
+		"KeepReplacedTokenWhenPreviousTokenWriteFails": {
+			cr:    newToken("alice", "old"),
+			grace: &metav1.Duration{Duration: time.Hour},
+			failWrite: func(s *corev1.Secret) bool {
+				_, ok := s.Data[keyPreviousToken]
+				return ok
+			},
+			wantErr:     true,
+			wantNew:     true,
+			wantValid:   []string{"alice/new", "alice/old"},
+			wantPending: []string{"alice/old"},
+		},
+		"RevokeNewTokenWhenSecretWriteFails": {
+			cr: newToken("alice", "old"),
+			failWrite: func(s *corev1.Secret) bool {
+				return string(s.Data["token"]) != tokenFor("alice", "old")
+			},
+			wantErr:   true,
+			wantValid: []string{"alice/old"},
+		},
+		"RevokeUnderRecordedAccount": {
+			cr: func() *tokensv1alpha1.Token {
+				cr := newToken("alice", "old")
+				cr.Spec.ForProvider.Account = "bob"
+				return cr
+			}(),
+			wantNew:   true,
+			wantValid: []string{"bob/new"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cr := tc.cr
+			cr.Spec.ForProvider.RotationGracePeriod = tc.grace
+			// A fixed id tells the minted token apart.
+			cr.Spec.ForProvider.ID = "new"
+
+			srv := newArgocdServer(cr.Status.AtProvider.Account + "/old")
+			for _, k := range tc.failRevoke {
+				srv.failRevoke[k] = true
+			}
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			secrets := &failingClient{
+				Client:    fake.NewClientBuilder().WithObjects(newTokenSecret(cr)).Build(),
+				failWrite: tc.failWrite,
+			}
+			e := newExternal(ts, secrets)
+			spec := cr.Spec.ForProvider
+
+			_, err := e.Update(context.Background(), cr)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Update(...): want error %t, got %v", tc.wantErr, err)
+			}
+
+			if got, want := strings.Join(srv.tokens(), ","), strings.Join(tc.wantValid, ","); got != want {
+				t.Errorf("Update(...): want valid tokens %q, got %q", want, got)
+			}
+
+			obs := cr.Status.AtProvider
+			wantID := "old"
+			if tc.wantNew {
+				wantID = "new"
+			}
+			if obs.ID != wantID {
+				t.Errorf("Update(...): want observed id %q, got %q", wantID, obs.ID)
+			}
+			if tc.wantNew && obs.Account != spec.Account {
+				t.Errorf("Update(...): want observed account %q, got %q", spec.Account, obs.Account)
+			}
+
+			pending := []string{}
+			for _, r := range obs.PendingRevocations {
+				pending = append(pending, r.Account+"/"+r.ID)
+			}
+			if got, want := strings.Join(pending, ","), strings.Join(tc.wantPending, ","); got != want {
+				t.Errorf("Update(...): want pending revocations %q, got %q", want, got)
+			}
+
+			s := &corev1.Secret{}
+			if err := secrets.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "ci-token"}, s); err != nil {
+				t.Fatalf("Get(...): unexpected error: %v", err)
+			}
+			if string(s.Data["token"]) != tokenFor(obs.Account, obs.ID) {
+				t.Errorf("Update(...): want the secret to hold the observed token %s/%s", obs.Account, obs.ID)
+			}
+			if _, ok := s.Data[keyPreviousToken]; ok != tc.wantPrevious {
+				t.Errorf("Update(...): want previous token in the secret %t, got %t", tc.wantPrevious, ok)
+			}
+		})
+	}
+}
+
+func TestRevokeReplacedTokens(t *testing.T) {
+	now := time.Now()
+	past := metav1.NewTime(now.Add(-time.Minute))
+	future := metav1.NewTime(now.Add(time.Hour))
+
+	cases := map[string]struct {
+		valid      []string
+		pending    []tokensv1alpha1.TokenRevocation
+		failRevoke []string
+
+		wantErr      bool
+		wantValid    []string
+		wantPending  []string
+		wantPrevious bool
+	}{
+		"RevokeDueTokens": {
+			valid: []string{"alice/a", "alice/b"},
+			pending: []tokensv1alpha1.TokenRevocation{
+				{ID: "a", Account: "alice", RevokeAt: past},
+				{ID: "b", RevokeAt: past},
+			},
+			wantValid: []string{},
+		},
+		"KeepTokensNotDueYet": {
+			valid: []string{"alice/a", "alice/b"},
+			pending: []tokensv1alpha1.TokenRevocation{
+				{ID: "a", Account: "alice", RevokeAt: past},
+				{ID: "b", Account: "alice", RevokeAt: future},
+			},
+			wantValid:    []string{"alice/b"},
+			wantPending:  []string{"b"},
+			wantPrevious: true,
+		},
+		"KeepUnrevokedTokens": {
+			valid: []string{"alice/a", "alice/b", "alice/c"},
+			pending: []tokensv1alpha1.TokenRevocation{
+				{ID: "a", Account: "alice", RevokeAt: past},
+				{ID: "b", Account: "alice", RevokeAt: past},
+				{ID: "c", Account: "alice", RevokeAt: future},
+			},
+			failRevoke:   []string{"alice/b"},
+			wantErr:      true,
+			wantValid:    []string{"alice/b", "alice/c"},
+			wantPending:  []string{"b", "c"},
+			wantPrevious: true,
+		},
+		"RevokeUnderRecordedAccount": {
+			valid: []string{"alice/a", "bob/a"},
+			pending: []tokensv1alpha1.TokenRevocation{
+				{ID: "a", Account: "bob", RevokeAt: past},
+			},
+			wantValid: []string{"alice/a"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cr := newToken("alice", "current")
+			cr.Status.AtProvider.PendingRevocations = tc.pending
+
+			srv := newArgocdServer(tc.valid...)
+			for _, k := range tc.failRevoke {
+				srv.failRevoke[k] = true
+			}
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			s := newTokenSecret(cr)
+			s.Data[keyPreviousToken] = []byte("previous")
+			secrets := fake.NewClientBuilder().WithObjects(s).Build()
+			e := newExternal(ts, secrets)
+
+			err := e.revokeReplacedTokens(context.Background(), cr, now)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("revokeReplacedTokens(...): want error %t, got %v", tc.wantErr, err)
+			}
+
+			if got, want := strings.Join(srv.tokens(), ","), strings.Join(tc.wantValid, ","); got != want {
+				t.Errorf("revokeReplacedTokens(...): want valid tokens %q, got %q", want, got)
+			}
+
+			pending := []string{}
+			for _, r := range cr.Status.AtProvider.PendingRevocations {
+				pending = append(pending, r.ID)
+			}
+			if got, want := strings.Join(pending, ","), strings.Join(tc.wantPending, ","); got != want {
+				t.Errorf("revokeReplacedTokens(...): want pending revocations %q, got %q", want, got)
+			}
+
+			cur := &corev1.Secret{}
+			if err := secrets.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "ci-token"}, cur); err != nil {
+				t.Fatalf("Get(...): unexpected error: %v", err)
+			}
+			if _, ok := cur.Data[keyPreviousToken]; ok != tc.wantPrevious {
+				t.Errorf("revokeReplacedTokens(...): want previous token in the secret %t, got %t", tc.wantPrevious, ok)
+			}
+		})
+	}
+}
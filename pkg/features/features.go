@@ -0,0 +1,11 @@
+// Package features defines the feature flags of this provider.
+package features
+
+import "github.com/crossplane/crossplane-runtime/pkg/feature"
+
+// Feature flags.
+const (
+	// EnableAlphaExternalSecretStores enables alpha support for publishing
+	// connection details to External Secret Stores.
+	EnableAlphaExternalSecretStores feature.Flag = "EnableAlphaExternalSecretStores"
+)
@@ -0,0 +1,178 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	errGenerateKey  = "cannot generate private key"
+	errCreateCert   = "cannot create certificate"
+	errWriteCertDir = "cannot write certificates"
+	errGetCerts     = "cannot get webhook certificates secret"
+	errSaveCerts    = "cannot save webhook certificates secret"
+
+	// certValidity is the validity of the serving certificate.
+	certValidity = 365 * 24 * time.Hour
+
+	// certRenewBefore is how long before its expiration the serving
+	// certificate is replaced, on start.
+	certRenewBefore = 30 * 24 * time.Hour
+
+	certFile = "tls.crt"
+	keyFile  = "tls.key"
+	caFile   = "ca.crt"
+)
+
+// EnsureCertificates writes the self-signed serving certificate for the
+// specified DNS names into the certificate directory. It returns the CA
+// bundle the API server has to trust.
+//
+// The certificate is shared by all the replicas through the referenced
+// secret: it is generated by the first replica to start, and replaced only
+// when it is about to expire or does not cover the DNS names anymore.
+func EnsureCertificates(ctx context.Context, kube client.Client, ref types.NamespacedName, certDir string, dnsNames []string) ([]byte, error) {
+	s := &corev1.Secret{}
+	err := kube.Get(ctx, ref, s)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, errors.Wrap(err, errGetCerts)
+	}
+	exists := err == nil
+
+	if !exists || !validCertificates(s, dnsNames, time.Now()) {
+		certPEM, keyPEM, err := generateCertificates(dnsNames)
+		if err != nil {
+			return nil, err
+		}
+
+		s.SetName(ref.Name)
+		s.SetNamespace(ref.Namespace)
+		s.Type = corev1.SecretTypeTLS
+		s.Data = map[string][]byte{
+			certFile: certPEM,
+			keyFile:  keyPEM,
+			caFile:   certPEM,
+		}
+
+		if exists {
+			err = kube.Update(ctx, s)
+		} else {
+			err = kube.Create(ctx, s)
+		}
+
+		// Another replica got there first: use its certificates.
+		if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+			if err := kube.Get(ctx, ref, s); err != nil {
+				return nil, errors.Wrap(err, errGetCerts)
+			}
+			err = nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, errSaveCerts)
+		}
+	}
+
+	if err := os.MkdirAll(certDir, 0o700); err != nil {
+		return nil, errors.Wrap(err, errWriteCertDir)
+	}
+	for _, name := range []string{certFile, keyFile} {
+		if err := writeFileIfChanged(filepath.Join(certDir, name), s.Data[name]); err != nil {
+			return nil, errors.Wrap(err, errWriteCertDir)
+		}
+	}
+
+	return s.Data[caFile], nil
+}
+
+// validCertificates returns true if the secret holds a certificate and key
+// pair covering the DNS names, not about to expire at the specified time.
+func validCertificates(s *corev1.Secret, dnsNames []string, now time.Time) bool {
+	if len(s.Data[caFile]) == 0 {
+		return false
+	}
+
+	pair, err := tls.X509KeyPair(s.Data[certFile], s.Data[keyFile])
+	if err != nil {
+		return false
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil || now.Add(certRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+
+	for _, name := range dnsNames {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// generateCertificates returns a new self-signed serving certificate for the
+// specified DNS names and its private key, PEM encoded.
+func generateCertificates(dnsNames []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errGenerateKey)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errCreateCert)
+	}
+
+	now := time.Now()
+	tpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:              dnsNames,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errCreateCert)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errGenerateKey)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	return certPEM, keyPEM, nil
+}
+
+// writeFileIfChanged writes the file unless it already holds the data.
+func writeFileIfChanged(path string, data []byte) error {
+	if cur, err := os.ReadFile(path); err == nil && bytes.Equal(cur, data) {
+		return nil
+	}
+	return os.WriteFile(path, data, 0o600)
+}
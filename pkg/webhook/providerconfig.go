@@ -0,0 +1,247 @@
+package webhook
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+
+	"github.com/krateoplatformops/provider-argocd-token/apis/v1alpha1"
+)
+
+const argocdInitialAdminSecret = "argocd-initial-admin-secret"
+
+// supportedCredentialsSources are the credentials sources the provider is
+// able to read.
+var supportedCredentialsSources = []xpv1.CredentialsSource{
+	xpv1.CredentialsSourceNone,
+	xpv1.CredentialsSourceSecret,
+	xpv1.CredentialsSourceEnvironment,
+	xpv1.CredentialsSourceFilesystem,
+}
+
+// providerConfigWebhook defaults and validates ProviderConfigs.
+type providerConfigWebhook struct{}
+
+func (w *providerConfigWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	pc, ok := obj.(*v1alpha1.ProviderConfig)
+	if !ok {
+		return errors.Errorf(errFmtUnexpectedType, obj)
+	}
+
+	pc.Spec.ServerUrl = strings.TrimSpace(pc.Spec.ServerUrl)
+
+	creds := pc.Spec.Credentials
+	if creds == nil {
+		return nil
+	}
+
+	if len(creds.Type) == 0 {
+		creds.Type = v1alpha1.CredentialsTypePassword
+	}
+
+	if creds.Source != xpv1.CredentialsSourceSecret {
+		return nil
+	}
+
+	// Same defaults the provider falls back to when reading the secret.
+	if creds.SecretRef == nil {
+		creds.SecretRef = &xpv1.SecretKeySelector{}
+	}
+	if len(strings.TrimSpace(creds.SecretRef.Name)) == 0 {
+		creds.SecretRef.Name = argocdInitialAdminSecret
+	}
+	if len(strings.TrimSpace(creds.SecretRef.Key)) == 0 {
+		creds.SecretRef.Key = corev1.BasicAuthPasswordKey
+	}
+
+	return nil
+}
+
+func (w *providerConfigWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	pc, ok := obj.(*v1alpha1.ProviderConfig)
+	if !ok {
+		return errors.Errorf(errFmtUnexpectedType, obj)
+	}
+
+	return toError(pc, validateProviderConfigSpec(pc.Spec))
+}
+
+func (w *providerConfigWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	old, ok := oldObj.(*v1alpha1.ProviderConfig)
+	if !ok {
+		return errors.Errorf(errFmtUnexpectedType, oldObj)
+	}
+	pc, ok := newObj.(*v1alpha1.ProviderConfig)
+	if !ok {
+		return errors.Errorf(errFmtUnexpectedType, newObj)
+	}
+
+	// Provider configs admitted before a rule was introduced must still be
+	// updatable, i.e. to remove their finalizer. The old one is defaulted as
+	// the new one has been.
+	if pc.GetDeletionTimestamp() != nil {
+		return nil
+	}
+	prev := old.DeepCopy()
+	if err := w.Default(ctx, prev); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(prev.Spec, pc.Spec) {
+		return nil
+	}
+
+	return w.ValidateCreate(ctx, newObj)
+}
+
+func (w *providerConfigWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+// validateProviderConfigSpec returns the errors of the provider config spec.
+func validateProviderConfigSpec(spec v1alpha1.ProviderConfigSpec) field.ErrorList {
+	path := field.NewPath("spec")
+
+	errs := field.ErrorList{}
+	if err := validateServerURL(spec.ServerUrl); err != nil {
+		errs = append(errs, field.Invalid(path.Child("serverUrl"), spec.ServerUrl, err.Error()))
+	}
+
+	if creds := spec.Credentials; creds != nil {
+		credsPath := path.Child("credentials")
+
+		supported := []string{}
+		for _, s := range supportedCredentialsSources {
+			supported = append(supported, string(s))
+		}
+		if !isSupportedCredentialsSource(creds.Source) {
+			errs = append(errs, field.NotSupported(credsPath.Child("source"), creds.Source, supported))
+		}
+
+		switch creds.Source {
+		case xpv1.CredentialsSourceSecret:
+			if creds.SecretRef == nil || len(strings.TrimSpace(creds.SecretRef.Namespace)) == 0 {
+				errs = append(errs, field.Required(credsPath.Child("secretRef", "namespace"), "secret namespace is required"))
+			}
+		case xpv1.CredentialsSourceEnvironment:
+			if creds.Env == nil || len(strings.TrimSpace(creds.Env.Name)) == 0 {
+				errs = append(errs, field.Required(credsPath.Child("env", "name"), "environment variable name is required"))
+			}
+		case xpv1.CredentialsSourceFilesystem:
+			if creds.Fs == nil || len(strings.TrimSpace(creds.Fs.Path)) == 0 {
+				errs = append(errs, field.Required(credsPath.Child("fs", "path"), "file path is required"))
+			}
+		}
+
+		if creds.Type == v1alpha1.CredentialsTypeToken && (len(creds.Username) > 0 || creds.UsernameSecretRef != nil) {
+			errs = append(errs, field.Forbidden(credsPath.Child("username"), "username cannot be set with Token credentials"))
+		}
+
+		if ref := creds.UsernameSecretRef; ref != nil {
+			errs = append(errs, validateSecretKeySelector(credsPath.Child("usernameSecretRef"), ref)...)
+		}
+	}
+
+	if cfg := spec.TLS; cfg != nil {
+		errs = append(errs, validateTLSConfig(path.Child("tls"), cfg)...)
+	}
+
+	if allowed := spec.AllowedSecretNamespaces; allowed != nil && allowed.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(allowed.Selector); err != nil {
+			errs = append(errs, field.Invalid(path.Child("allowedSecretNamespaces", "selector"), allowed.Selector, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+// validateTLSConfig returns the errors of the TLS configuration.
+func validateTLSConfig(path *field.Path, cfg *v1alpha1.TLSConfig) field.ErrorList {
+	errs := field.ErrorList{}
+	if cfg.CABundleSecretRef != nil && cfg.CABundleConfigMapRef != nil {
+		errs = append(errs, field.Forbidden(path.Child("caBundleConfigMapRef"), "caBundleSecretRef and caBundleConfigMapRef are mutually exclusive"))
+	}
+
+	if ref := cfg.CABundleSecretRef; ref != nil {
+		errs = append(errs, validateSecretKeySelector(path.Child("caBundleSecretRef"), ref)...)
+	}
+
+	if ref := cfg.CABundleConfigMapRef; ref != nil {
+		refPath := path.Child("caBundleConfigMapRef")
+		if len(strings.TrimSpace(ref.Name)) == 0 {
+			errs = append(errs, field.Required(refPath.Child("name"), "config map name is required"))
+		}
+		if len(strings.TrimSpace(ref.Namespace)) == 0 {
+			errs = append(errs, field.Required(refPath.Child("namespace"), "config map namespace is required"))
+		}
+		if len(strings.TrimSpace(ref.Key)) == 0 {
+			errs = append(errs, field.Required(refPath.Child("key"), "config map key is required"))
+		}
+	}
+
+	if ref := cfg.ClientCertSecretRef; ref != nil {
+		refPath := path.Child("clientCertSecretRef")
+		if len(strings.TrimSpace(ref.Name)) == 0 {
+			errs = append(errs, field.Required(refPath.Child("name"), "secret name is required"))
+		}
+		if len(strings.TrimSpace(ref.Namespace)) == 0 {
+			errs = append(errs, field.Required(refPath.Child("namespace"), "secret namespace is required"))
+		}
+	}
+
+	return errs
+}
+
+// validateSecretKeySelector returns the errors of a secret key reference.
+func validateSecretKeySelector(path *field.Path, ref *xpv1.SecretKeySelector) field.ErrorList {
+	errs := field.ErrorList{}
+	if len(strings.TrimSpace(ref.Name)) == 0 {
+		errs = append(errs, field.Required(path.Child("name"), "secret name is required"))
+	}
+	if len(strings.TrimSpace(ref.Namespace)) == 0 {
+		errs = append(errs, field.Required(path.Child("namespace"), "secret namespace is required"))
+	}
+	if len(strings.TrimSpace(ref.Key)) == 0 {
+		errs = append(errs, field.Required(path.Child("key"), "secret key is required"))
+	}
+	return errs
+}
+
+// validateServerURL returns an error unless the url is an absolute http(s) url.
+func validateServerURL(s string) error {
+	if len(s) == 0 {
+		return errors.New("server url is required")
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("unsupported scheme %q, must be http or https", u.Scheme)
+	}
+
+	if len(u.Host) == 0 {
+		return errors.New("server url has no host")
+	}
+
+	return nil
+}
+
+func isSupportedCredentialsSource(src xpv1.CredentialsSource) bool {
+	for _, s := range supportedCredentialsSources {
+		if s == src {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	tokensv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/tokens/v1alpha1"
+)
+
+// A tokenResource is any kind of token.
+type tokenResource interface {
+	runtime.Object
+	metav1.Object
+	GetTokenParameters() tokensv1alpha1.TokenParameters
+}
+
+// tokenWebhook defaults and validates Tokens and NamespacedTokens.
+type tokenWebhook struct{}
+
+func (w *tokenWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	switch cr := obj.(type) {
+	case *tokensv1alpha1.Token:
+		defaultTokenParameters(&cr.Spec.ForProvider.CommonTokenParameters)
+		ref := &cr.Spec.ForProvider.WriteTokenSecretToRef
+		ref.Name = strings.TrimSpace(ref.Name)
+		ref.Namespace = strings.TrimSpace(ref.Namespace)
+		ref.Key = strings.TrimSpace(ref.Key)
+	case *tokensv1alpha1.NamespacedToken:
+		defaultTokenParameters(&cr.Spec.ForProvider.CommonTokenParameters)
+		ref := &cr.Spec.ForProvider.WriteTokenSecretToRef
+		ref.Name = strings.TrimSpace(ref.Name)
+		ref.Key = strings.TrimSpace(ref.Key)
+	default:
+		return errors.Errorf(errFmtUnexpectedType, obj)
+	}
+	return nil
+}
+
+func (w *tokenWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	cr, ok := obj.(tokenResource)
+	if !ok {
+		return errors.Errorf(errFmtUnexpectedType, obj)
+	}
+
+	return toError(cr, validateTokenParameters(cr.GetTokenParameters()))
+}
+
+func (w *tokenWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	old, ok := oldObj.(tokenResource)
+	if !ok {
+		return errors.Errorf(errFmtUnexpectedType, oldObj)
+	}
+	cr, ok := newObj.(tokenResource)
+	if !ok {
+		return errors.Errorf(errFmtUnexpectedType, newObj)
+	}
+
+	// Tokens cannot move to another account: the minted token would belong
+	// to the old one.
+	path := field.NewPath("spec", "forProvider", "account")
+	if prev, cur := old.GetTokenParameters().Account, cr.GetTokenParameters().Account; prev != cur {
+		return toError(cr, field.ErrorList{field.Invalid(path, cur, "account is immutable")})
+	}
+
+	// Tokens admitted before a rule was introduced must still be updatable
+	// by the provider, i.e. to remove their finalizer. The old one is
+	// defaulted as the new one has been.
+	if cr.GetDeletionTimestamp() != nil {
+		return nil
+	}
+	prev := old.DeepCopyObject()
+	if err := w.Default(ctx, prev); err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(prev.(tokenResource).GetTokenParameters(), cr.GetTokenParameters()) {
+		return nil
+	}
+
+	return toError(cr, validateTokenParameters(cr.GetTokenParameters()))
+}
+
+func (w *tokenWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+// defaultTokenParameters sets the defaults of the token parameters.
+func defaultTokenParameters(p *tokensv1alpha1.CommonTokenParameters) {
+	p.Account = strings.TrimSpace(p.Account)
+	p.RotationSchedule = strings.TrimSpace(p.RotationSchedule)
+
+	if len(p.SecretPolicy) == 0 {
+		p.SecretPolicy = tokensv1alpha1.SecretPolicyFailIfExists
+	}
+}
+
+// validateTokenParameters returns the errors of the token parameters.
+func validateTokenParameters(p tokensv1alpha1.TokenParameters) field.ErrorList {
+	path := field.NewPath("spec", "forProvider")
+
+	errs := field.ErrorList{}
+	if len(p.Account) == 0 {
+		errs = append(errs, field.Required(path.Child("account"), "account is required"))
+	}
+
+	for name, d := range map[string]*metav1.Duration{
+		"expiresIn":           p.ExpiresIn,
+		"renewBefore":         p.RenewBefore,
+		"rotationGracePeriod": p.RotationGracePeriod,
+	} {
+		if d != nil && d.Duration < 0 {
+			errs = append(errs, field.Invalid(path.Child(name), d.Duration.String(), "must not be negative"))
+		}
+	}
+
+	if p.ExpiresIn != nil && p.RenewBefore != nil && p.RenewBefore.Duration >= p.ExpiresIn.Duration {
+		errs = append(errs, field.Invalid(path.Child("renewBefore"), p.RenewBefore.Duration.String(), "must be shorter than expiresIn"))
+	}
+
+	if len(p.RotationSchedule) > 0 {
+		if _, err := cron.ParseStandard(p.RotationSchedule); err != nil {
+			errs = append(errs, field.Invalid(path.Child("rotationSchedule"), p.RotationSchedule, err.Error()))
+		}
+	}
+
+	ref := p.WriteTokenSecretToRef
+	refPath := path.Child("writeTokenSecretToRef")
+	if len(ref.Name) == 0 {
+		errs = append(errs, field.Required(refPath.Child("name"), "secret name is required"))
+	}
+	if len(ref.Namespace) == 0 {
+		errs = append(errs, field.Required(refPath.Child("namespace"), "secret namespace is required"))
+	}
+	if len(ref.Key) == 0 {
+		errs = append(errs, field.Required(refPath.Child("key"), "secret key is required"))
+	}
+	if ref.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(ref.NamespaceSelector); err != nil {
+			errs = append(errs, field.Invalid(refPath.Child("namespaceSelector"), ref.NamespaceSelector, err.Error()))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,274 @@
+// Package webhook implements the admission webhooks defaulting and
+// validating the provider resources.
+package webhook
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tokensv1alpha1 "github.com/krateoplatformops/provider-argocd-token/apis/tokens/v1alpha1"
+	"github.com/krateoplatformops/provider-argocd-token/apis/v1alpha1"
+)
+
+const (
+	errFmtUnexpectedType = "unexpected type %T"
+	errSetupWebhook      = "cannot setup webhook"
+	errApplyConfig       = "cannot apply webhook configuration"
+	errDeleteConfig      = "cannot delete webhook configuration"
+	errGetOwner          = "cannot get webhook configuration owner"
+	errFmtGetService     = "cannot get webhook service %s/%s: it must exist before enabling the webhooks"
+
+	// configurationName is the name of the webhook configurations.
+	configurationName = "provider-argocd-token"
+)
+
+// ownerCRD is the definition owning the webhook configurations, so that they
+// are garbage collected along with the provider package: being cluster scoped,
+// they cannot be owned by the provider deployment. Usages have no finalizers,
+// so their definition goes away without waiting for the finalizers of tokens
+// and provider configs, whose removal the webhooks would block.
+var ownerCRD = types.NamespacedName{Name: "providerconfigusages." + v1alpha1.Group}
+
+// Service exposing the webhook server within the cluster.
+type Service struct {
+	Name      string
+	Namespace string
+	Port      int32
+}
+
+// DNSNames returns the names the service is reachable at from the API server.
+func (s Service) DNSNames() []string {
+	return []string{
+		s.Name,
+		s.Name + "." + s.Namespace,
+		s.Name + "." + s.Namespace + ".svc",
+		s.Name + "." + s.Namespace + ".svc.cluster.local",
+	}
+}
+
+// Setup registers the defaulting and validating webhooks of the provider
+// resources into the manager webhook server.
+func Setup(mgr ctrl.Manager) error {
+	for _, obj := range []client.Object{&tokensv1alpha1.Token{}, &tokensv1alpha1.NamespacedToken{}} {
+		err := ctrl.NewWebhookManagedBy(mgr).
+			For(obj).
+			WithDefaulter(&tokenWebhook{}).
+			WithValidator(&tokenWebhook{}).
+			Complete()
+		if err != nil {
+			return errors.Wrap(err, errSetupWebhook)
+		}
+	}
+
+	err := ctrl.NewWebhookManagedBy(mgr).
+		For(&v1alpha1.ProviderConfig{}).
+		WithDefaulter(&providerConfigWebhook{}).
+		WithValidator(&providerConfigWebhook{}).
+		Complete()
+	return errors.Wrap(err, errSetupWebhook)
+}
+
+// Configure creates or updates the webhook configurations pointing the API
+// server to the webhook service, trusting the specified CA bundle. The
+// service must exist: every admission would fail otherwise.
+func Configure(ctx context.Context, kube client.Client, svc Service, caBundle []byte) error {
+	if err := kube.Get(ctx, types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}, &corev1.Service{}); err != nil {
+		return errors.Wrapf(err, errFmtGetService, svc.Namespace, svc.Name)
+	}
+
+	crd := &metav1.PartialObjectMetadata{}
+	crd.SetGroupVersionKind(apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
+	if err := kube.Get(ctx, ownerCRD, crd); err != nil {
+		return errors.Wrap(err, errGetOwner)
+	}
+	owners := []metav1.OwnerReference{{
+		APIVersion: apiextensionsv1.SchemeGroupVersion.String(),
+		Kind:       "CustomResourceDefinition",
+		Name:       crd.GetName(),
+		UID:        crd.GetUID(),
+	}}
+
+	kinds := []struct {
+		gvk      schema.GroupVersionKind
+		resource string
+		scope    admissionregistrationv1.ScopeType
+	}{
+		{tokensv1alpha1.TokenGroupVersionKind, "tokens", admissionregistrationv1.ClusterScope},
+		{tokensv1alpha1.NamespacedTokenGroupVersionKind, "namespacedtokens", admissionregistrationv1.NamespacedScope},
+		{v1alpha1.ProviderConfigGroupVersionKind, "providerconfigs", admissionregistrationv1.ClusterScope},
+	}
+
+	om := metav1.ObjectMeta{Name: configurationName, OwnerReferences: owners}
+	mwc := &admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: om}
+	vwc := &admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: *om.DeepCopy()}
+
+	failurePolicy := admissionregistrationv1.Fail
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	for _, k := range kinds {
+		k := k
+		rules := []admissionregistrationv1.RuleWithOperations{{
+			Operations: []admissionregistrationv1.OperationType{
+				admissionregistrationv1.Create,
+				admissionregistrationv1.Update,
+			},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{k.gvk.Group},
+				APIVersions: []string{k.gvk.Version},
+				Resources:   []string{k.resource},
+				Scope:       &k.scope,
+			},
+		}}
+		name := k.resource + "." + k.gvk.Group
+
+		mwc.Webhooks = append(mwc.Webhooks, admissionregistrationv1.MutatingWebhook{
+			Name:                    name,
+			ClientConfig:            clientConfig(svc, webhookPath("mutate", k.gvk), caBundle),
+			Rules:                   rules,
+			FailurePolicy:           &failurePolicy,
+			SideEffects:             &sideEffects,
+			AdmissionReviewVersions: []string{"v1"},
+		})
+
+		vwc.Webhooks = append(vwc.Webhooks, admissionregistrationv1.ValidatingWebhook{
+			Name:                    name,
+			ClientConfig:            clientConfig(svc, webhookPath("validate", k.gvk), caBundle),
+			Rules:                   rules,
+			FailurePolicy:           &failurePolicy,
+			SideEffects:             &sideEffects,
+			AdmissionReviewVersions: []string{"v1"},
+		})
+	}
+
+	if err := apply(ctx, kube, mwc, &admissionregistrationv1.MutatingWebhookConfiguration{}, func(cur client.Object) bool {
+		c := cur.(*admissionregistrationv1.MutatingWebhookConfiguration)
+		if equality.Semantic.DeepEqual(mutatingFields(c.Webhooks), mutatingFields(mwc.Webhooks)) &&
+			equality.Semantic.DeepEqual(c.OwnerReferences, owners) {
+			return false
+		}
+		c.Webhooks = mwc.Webhooks
+		c.OwnerReferences = owners
+		return true
+	}); err != nil {
+		return err
+	}
+
+	return apply(ctx, kube, vwc, &admissionregistrationv1.ValidatingWebhookConfiguration{}, func(cur client.Object) bool {
+		c := cur.(*admissionregistrationv1.ValidatingWebhookConfiguration)
+		if equality.Semantic.DeepEqual(validatingFields(c.Webhooks), validatingFields(vwc.Webhooks)) &&
+			equality.Semantic.DeepEqual(c.OwnerReferences, owners) {
+			return false
+		}
+		c.Webhooks = vwc.Webhooks
+		c.OwnerReferences = owners
+		return true
+	})
+}
+
+// Unconfigure deletes the webhook configurations, if any, so that admissions
+// do not fail once the webhooks are disabled.
+func Unconfigure(ctx context.Context, kube client.Client) error {
+	for _, obj := range []client.Object{
+		&admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: configurationName}},
+		&admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: configurationName}},
+	} {
+		if err := kube.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return errors.Wrap(err, errDeleteConfig)
+		}
+	}
+
+	return nil
+}
+
+// apply creates the desired object, or updates the current one if mutate
+// changes it. Replicas starting together thus do not fight over it.
+func apply(ctx context.Context, kube client.Client, desired, cur client.Object, mutate func(client.Object) bool) error {
+	err := kube.Get(ctx, types.NamespacedName{Name: desired.GetName()}, cur)
+	if apierrors.IsNotFound(err) {
+		err := kube.Create(ctx, desired)
+		if apierrors.IsAlreadyExists(err) {
+			return apply(ctx, kube, desired, cur, mutate)
+		}
+		return errors.Wrap(err, errApplyConfig)
+	}
+	if err != nil {
+		return errors.Wrap(err, errApplyConfig)
+	}
+
+	if !mutate(cur) {
+		return nil
+	}
+
+	err = kube.Update(ctx, cur)
+	if apierrors.IsConflict(err) {
+		return apply(ctx, kube, desired, cur, mutate)
+	}
+	return errors.Wrap(err, errApplyConfig)
+}
+
+// webhookFields are the fields of a webhook set by Configure; the others are
+// defaulted by the API server.
+type webhookFields struct {
+	Name                    string
+	ClientConfig            admissionregistrationv1.WebhookClientConfig
+	Rules                   []admissionregistrationv1.RuleWithOperations
+	FailurePolicy           *admissionregistrationv1.FailurePolicyType
+	SideEffects             *admissionregistrationv1.SideEffectClass
+	AdmissionReviewVersions []string
+}
+
+func mutatingFields(webhooks []admissionregistrationv1.MutatingWebhook) []webhookFields {
+	res := make([]webhookFields, 0, len(webhooks))
+	for _, w := range webhooks {
+		res = append(res, webhookFields{w.Name, w.ClientConfig, w.Rules, w.FailurePolicy, w.SideEffects, w.AdmissionReviewVersions})
+	}
+	return res
+}
+
+func validatingFields(webhooks []admissionregistrationv1.ValidatingWebhook) []webhookFields {
+	res := make([]webhookFields, 0, len(webhooks))
+	for _, w := range webhooks {
+		res = append(res, webhookFields{w.Name, w.ClientConfig, w.Rules, w.FailurePolicy, w.SideEffects, w.AdmissionReviewVersions})
+	}
+	return res
+}
+
+func clientConfig(svc Service, path string, caBundle []byte) admissionregistrationv1.WebhookClientConfig {
+	return admissionregistrationv1.WebhookClientConfig{
+		Service: &admissionregistrationv1.ServiceReference{
+			Name:      svc.Name,
+			Namespace: svc.Namespace,
+			Path:      &path,
+			Port:      &svc.Port,
+		},
+		CABundle: caBundle,
+	}
+}
+
+// webhookPath returns the path the controller-runtime serves the webhook of
+// the specified kind at.
+func webhookPath(prefix string, gvk schema.GroupVersionKind) string {
+	return "/" + prefix + "-" + strings.ReplaceAll(gvk.Group, ".", "-") + "-" +
+		gvk.Version + "-" + strings.ToLower(gvk.Kind)
+}
+
+// toError returns an Invalid error for the object, nil if no errors.
+func toError(obj client.Object, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(obj.GetObjectKind().GroupVersionKind().GroupKind(), obj.GetName(), errs)
+}